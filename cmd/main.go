@@ -12,12 +12,29 @@ import (
 	"user-management-service/internal/broker/rabbitmq"
 	"user-management-service/internal/cache/redis"
 	"user-management-service/internal/config"
+	adminhandler "user-management-service/internal/http-server/handlers/admin"
 	authhandler "user-management-service/internal/http-server/handlers/auth"
+	grouphandler "user-management-service/internal/http-server/handlers/group"
 	"user-management-service/internal/http-server/handlers/healthcheck"
+	"user-management-service/internal/http-server/handlers/jwks"
+	mfahandler "user-management-service/internal/http-server/handlers/mfa"
+	oauthhandler "user-management-service/internal/http-server/handlers/oauth"
+	"user-management-service/internal/http-server/handlers/openid"
+	serviceaccounthandler "user-management-service/internal/http-server/handlers/serviceaccount"
+	sessionhandler "user-management-service/internal/http-server/handlers/session"
+	tokenhandler "user-management-service/internal/http-server/handlers/token"
 	userhabdler "user-management-service/internal/http-server/handlers/user"
+	authmw "user-management-service/internal/http-server/middleware/auth"
+	"user-management-service/internal/http-server/middleware/logging"
+	"user-management-service/internal/http-server/middleware/ratelimit"
+	"user-management-service/internal/lib/jwt"
 	"user-management-service/internal/lib/logger"
 	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/models"
 	authservice "user-management-service/internal/service/auth"
+	groupservice "user-management-service/internal/service/group"
+	oauthservice "user-management-service/internal/service/oauth"
+	serviceaccountservice "user-management-service/internal/service/serviceaccount"
 	userservice "user-management-service/internal/service/user"
 	"user-management-service/internal/storage/postgres"
 
@@ -39,6 +56,32 @@ func main() {
 	}
 	log.Debug("storage initialized")
 
+	// Schema
+	migrator, err := storage.Migrator()
+	if err != nil {
+		log.Error("failed to init migrator", sl.Error(err))
+		os.Exit(1)
+	}
+
+	err = migrator.Check(context.Background())
+	if err != nil {
+		log.Error("database schema is not up to date, run `migrate up`", sl.Error(err))
+		os.Exit(1)
+	}
+	log.Debug("schema checked")
+
+	// Token signing keys
+	keysCtx, stopKeys := context.WithCancel(context.Background())
+	defer stopKeys()
+
+	keys, err := jwt.NewKeySet(keysCtx, storage, cfg.Token)
+	if err != nil {
+		log.Error("failed to init signing keys", sl.Error(err))
+		os.Exit(1)
+	}
+	go keys.Run(keysCtx, log)
+	log.Debug("signing keys initialized")
+
 	// Cache
 	cache, err := redis.New(cfg.Cache)
 	if err != nil {
@@ -47,6 +90,17 @@ func main() {
 	}
 	log.Debug("cache initialized")
 
+	// Revoked tokens used to be kept in a set which never expired. They are only
+	// checked in their new place, so the set is drained before serving any request.
+	n, err := cache.DrainLegacyBlacklist(context.Background(), cfg.Token.Refresh.TTL)
+	if err != nil {
+		log.Error("failed to drain legacy token blacklist", sl.Error(err))
+		os.Exit(1)
+	}
+	if n > 0 {
+		log.Info("legacy token blacklist drained", slog.Int("tokens", n))
+	}
+
 	// Broker
 	broker, err := rabbitmq.New(cfg.Broker)
 	if err != nil {
@@ -56,23 +110,89 @@ func main() {
 	log.Debug("broker initialized")
 
 	// Service layer
-	authService := authservice.New(log, storage, cache, broker, cfg.Token)
-	userService := userservice.New(log, storage)
+	authService := authservice.New(log, storage, cache, broker, keys, cfg.Token, cfg.Auth, cfg.Deadlines)
+	userService := userservice.New(log, storage, cache, cfg.Token, cfg.Deadlines)
+	groupService := groupservice.New(log, storage, cfg.Deadlines)
+	serviceAccountService := serviceaccountservice.New(log, storage, cache, cfg.Token, cfg.Deadlines)
+	oauthService := oauthservice.New(log, storage, cache, authService, keys, cfg.Token, cfg.OAuth, cfg.Deadlines)
+
+	// Answers about revoked access tokens are cached by every replica for a while
+	denylist := authmw.NewCachedDenylist(cache, cfg.Auth.RevocationCacheTTL, cfg.Auth.RevocationCacheSize)
 
 	// Constroller layer
 	r := chi.NewRouter()
 
-	// r.Use(middleware.RequestID)
-	// r.Use(middleware.RealIP)
-	// r.Use(middleware.Logger)
-	// r.Use(middleware.Recoverer)
+	r.Use(logging.RequestID)
+	r.Use(logging.RealIP(cfg.TrustedProxies))
+	r.Use(logging.AccessLog(log))
+	r.Use(logging.Recover(log))
+
+	// Anonymous routes which are costly or abusable are limited per client address
+	limiter := ratelimit.New(log, cache, cfg.RateLimit)
+	r.Use(
+		limiter.Route(ratelimit.Policy{Name: "signup", Rate: cfg.RateLimit.Signup, Key: ratelimit.ByIP},
+			http.MethodPost, "/auth/signup"),
+		limiter.Route(ratelimit.Policy{Name: "login", Rate: cfg.RateLimit.Login, Key: ratelimit.ByIP},
+			http.MethodPost, "/auth/login", "/auth/login/mfa"),
+		limiter.Route(ratelimit.Policy{Name: "reset-password", Rate: cfg.RateLimit.ResetPassword, Key: ratelimit.ByIP},
+			http.MethodPost, "/auth/reset-password", "/auth/resend-verification"),
+		limiter.Route(ratelimit.Policy{Name: "token", Rate: cfg.RateLimit.Token, Key: ratelimit.ByIP},
+			http.MethodPost, "/auth/refresh-token", "/oauth/token"),
+	)
 
 	auth := authhandler.New(log, authService, cfg.Token)
-	user := userhabdler.New(log, userService, cfg.Token)
+	user := userhabdler.New(log, userService)
+	mfa := mfahandler.New(log, authService)
+	admin := adminhandler.New(log, userService)
+	group := grouphandler.New(log, groupService)
+	session := sessionhandler.New(log, authService)
+	token := tokenhandler.New(log, authService)
+	oauth := oauthhandler.New(log, oauthService)
+	serviceAccount := serviceaccounthandler.New(log, serviceAccountService)
 
 	r.HandleFunc("/healthcheck", healthcheck.Register())
+	r.Get("/.well-known/jwks.json", jwks.Register(keys, cfg.Token.JWT.ReloadInterval))
+	r.Get("/.well-known/openid-configuration", openid.Register(cfg.OAuth.Issuer, cfg.Token.JWT.Algorithm, oauthservice.Scopes, time.Hour))
 	r.Route("/auth", auth.Register())
-	r.Route("/users", user.Register())
+	r.Route("/oauth", oauth.Register())
+
+	// Routes below require an access token. Each of them declares the permission it needs with
+	// authmw.RequirePermission, which personal access tokens need a scope for, or refuses
+	// personal access tokens with authmw.RejectPersonalTokens
+	r.Group(func(r chi.Router) {
+		r.Use(authmw.New(log, keys, denylist, authService))
+		r.Use(limiter.Limit(ratelimit.Policy{Name: "api", Rate: cfg.RateLimit.API, Key: ratelimit.ByAPIKey}))
+
+		// OpenID Connect clients read the claims their scopes cover
+		r.Group(func(r chi.Router) {
+			r.Use(authmw.RequirePrincipalType(models.PrincipalUser))
+
+			r.Get("/userinfo", oauth.UserInfo())
+			r.Post("/userinfo", oauth.UserInfo())
+		})
+
+		// The rest is the service's own API, which OAuth tokens have no access to
+		r.Group(func(r chi.Router) {
+			r.Use(authmw.RejectDelegated())
+
+			r.Route("/groups", group.Register())
+			r.Route("/admin", admin.Register())
+			r.Route("/admin/service-accounts", serviceAccount.Register())
+			r.Route("/oauth/clients", oauth.RegisterClients())
+
+			// Service accounts have no account of their own here
+			r.Group(func(r chi.Router) {
+				r.Use(authmw.RequirePrincipalType(models.PrincipalUser))
+
+				r.Route("/users", user.Register())
+				r.Route("/users/me/mfa", mfa.Register())
+				r.Route("/users/me/tokens", token.Register())
+				r.Route("/users/me/groups", group.RegisterMe())
+				r.Route("/users/me/sessions", session.Register())
+				r.Route("/oauth/authorize", oauth.RegisterAuthorize())
+			})
+		})
+	})
 
 	// Server
 	srv := http.Server{
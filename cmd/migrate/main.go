@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/storage/postgres"
+	"user-management-service/internal/storage/postgres/migrator"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    revert the last N applied migrations (default 1)
+  status      list migrations and whether they are applied`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.MustLoad()
+
+	log := logger.New(cfg.Env)
+
+	storage, err := postgres.New(cfg.Storage)
+	if err != nil {
+		log.Error("failed to init storage", sl.Error(err))
+		os.Exit(1)
+	}
+	defer storage.Close()
+
+	m, err := storage.Migrator()
+	if err != nil {
+		log.Error("failed to init migrator", sl.Error(err))
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := m.Up(ctx)
+		logMigrations(log, "applied migration", applied)
+		if err != nil {
+			log.Error("failed to apply migrations", sl.Error(err))
+			os.Exit(1)
+		}
+		log.Info("schema is up to date", slog.Int("applied", len(applied)))
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, usage)
+				os.Exit(2)
+			}
+		}
+
+		reverted, err := m.Down(ctx, steps)
+		logMigrations(log, "reverted migration", reverted)
+		if err != nil {
+			log.Error("failed to revert migrations", sl.Error(err))
+			os.Exit(1)
+		}
+		log.Info("migrations reverted", slog.Int("reverted", len(reverted)))
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			log.Error("failed to get migrations status", sl.Error(err))
+			os.Exit(1)
+		}
+
+		for _, st := range statuses {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d  %-40s %s\n", st.Version, st.Name, applied)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func logMigrations(log *slog.Logger, msg string, migrations []migrator.Migration) {
+	for _, mig := range migrations {
+		log.Info(msg, slog.Int64("version", mig.Version), slog.String("name", mig.Name))
+	}
+}
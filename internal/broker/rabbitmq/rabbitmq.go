@@ -2,16 +2,20 @@ package rabbitmq
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"user-management-service/internal/config"
+	"user-management-service/internal/models"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type Broker struct {
-	ch        *amqp.Channel
-	queueName string
+	ch                    *amqp.Channel
+	queueName             string
+	verificationQueueName string
+	securityQueueName     string
 }
 
 func New(cfg config.Broker) (*Broker, error) {
@@ -25,35 +29,110 @@ func New(cfg config.Broker) (*Broker, error) {
 		return nil, err
 	}
 
-	_, err = ch.QueueDeclare(
-		cfg.QueueName,
+	for _, queue := range []string{cfg.QueueName, cfg.VerificationQueueName, cfg.SecurityQueueName} {
+		_, err = ch.QueueDeclare(
+			queue,
+			false,
+			false,
+			false,
+			false,
+			nil,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Broker{
+		ch:                    ch,
+		queueName:             cfg.QueueName,
+		verificationQueueName: cfg.VerificationQueueName,
+		securityQueueName:     cfg.SecurityQueueName,
+	}, nil
+}
+
+type resetPasswordMessage struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+}
+
+func (b *Broker) ResetPassword(ctx context.Context, email, token string) error {
+	const op = "ResetPassword"
+
+	body, err := json.Marshal(resetPasswordMessage{
+		Email: email,
+		Token: token,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = b.ch.PublishWithContext(ctx,
+		"",
+		b.queueName,
 		false,
 		false,
+		amqp.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+type verifyEmailMessage struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+}
+
+func (b *Broker) VerifyEmail(ctx context.Context, email, token string) error {
+	const op = "VerifyEmail"
+
+	body, err := json.Marshal(verifyEmailMessage{
+		Email: email,
+		Token: token,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = b.ch.PublishWithContext(ctx,
+		"",
+		b.verificationQueueName,
 		false,
 		false,
-		nil,
+		amqp.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+		},
 	)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &Broker{
-		ch:        ch,
-		queueName: cfg.QueueName,
-	}, nil
+	return nil
 }
 
-func (b *Broker) ResetPassword(ctx context.Context, email string) error {
-	const op = "ResetPassword"
+func (b *Broker) SecurityEvent(ctx context.Context, event models.SecurityEvent) error {
+	const op = "SecurityEvent"
 
-	err := b.ch.PublishWithContext(ctx,
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = b.ch.PublishWithContext(ctx,
 		"",
-		b.queueName,
+		b.securityQueueName,
 		false,
 		false,
 		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        []byte(email),
+			ContentType: "application/json",
+			Body:        body,
 		},
 	)
 	if err != nil {
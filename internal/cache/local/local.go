@@ -0,0 +1,78 @@
+package local
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache is a bounded in-process cache whose entries expire ttl after they were set
+type Cache[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]entry[V]
+}
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// New returns a cache keeping up to size entries, for ttl each unless set with SetFor
+func New[V any](ttl time.Duration, size int) *Cache[V] {
+	return &Cache[V]{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]entry[V]),
+	}
+}
+
+// Get returns the value of key unless it is missing or expired
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || !time.Now().Before(e.expiresAt) {
+		var zero V
+		return zero, false
+	}
+
+	return e.value, true
+}
+
+// Set stores the value of key for the cache's ttl
+func (c *Cache[V]) Set(key string, value V) {
+	c.SetFor(key, value, c.ttl)
+}
+
+// SetFor stores the value of key for ttl. When the cache is full the expired entries
+// are dropped, and if there are none, an arbitrary one makes room.
+func (c *Cache[V]) SetFor(key string, value V, ttl time.Duration) {
+	if ttl <= 0 || c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = entry[V]{
+		value:     value,
+		expiresAt: now.Add(ttl),
+	}
+}
@@ -0,0 +1,62 @@
+package local
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		size   int
+		set    []string
+		wait   time.Duration
+		key    string
+		wantOk bool
+	}{
+		{name: "hit", ttl: time.Minute, size: 2, set: []string{"a"}, key: "a", wantOk: true},
+		{name: "miss", ttl: time.Minute, size: 2, set: []string{"a"}, key: "b", wantOk: false},
+		{name: "expired", ttl: time.Millisecond, size: 2, set: []string{"a"}, wait: 5 * time.Millisecond, key: "a", wantOk: false},
+		{name: "latest kept when full", ttl: time.Minute, size: 2, set: []string{"a", "b", "c"}, key: "c", wantOk: true},
+		{name: "disabled", ttl: 0, size: 2, set: []string{"a"}, key: "a", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[int](tt.ttl, tt.size)
+			for i, key := range tt.set {
+				c.Set(key, i)
+			}
+			time.Sleep(tt.wait)
+
+			_, ok := c.Get(tt.key)
+			if ok != tt.wantOk {
+				t.Errorf("Get(%q) ok = %v, want %v", tt.key, ok, tt.wantOk)
+			}
+			if len(c.entries) > tt.size {
+				t.Errorf("cache holds %d entries, want at most %d", len(c.entries), tt.size)
+			}
+		})
+	}
+}
+
+func TestCacheSetFor(t *testing.T) {
+	c := New[int](0, 2)
+
+	c.SetFor("short", 1, time.Millisecond)
+	c.SetFor("long", 2, time.Minute)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("short"); ok {
+		t.Error("Get(\"short\") ok = true after its ttl")
+	}
+	if v, ok := c.Get("long"); !ok || v != 2 {
+		t.Errorf("Get(\"long\") = %v, %v, want 2, true", v, ok)
+	}
+
+	// The expired entry makes room rather than the live one
+	c.SetFor("next", 3, time.Minute)
+	if _, ok := c.Get("long"); !ok {
+		t.Error("live entry dropped while an expired one was there")
+	}
+}
@@ -0,0 +1,188 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"user-management-service/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// reserveLoginScript counts a login attempt as failed in the sorted set KEYS[2], unless the
+// account is locked by KEYS[1] or the last failed login was too recent, in milliseconds of the
+// Redis clock. ARGV[1] is the window failures are counted in, ARGV[2] the attempt's member and
+// ARGV[3..] how long to wait after the first, second and further failures. It returns 1 and the
+// lock's remaining time, 2 and the time to wait, or 0 and the failures counting the attempt.
+var reserveLoginScript = redis.NewScript(`
+local window = tonumber(ARGV[1])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local locked = redis.call('PTTL', KEYS[1])
+if locked > 0 then
+	return {1, locked}
+end
+
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', '(' .. string.format('%.0f', now - window))
+local n = redis.call('ZCARD', KEYS[2])
+if n > 0 and #ARGV > 2 then
+	local last = tonumber(redis.call('ZRANGE', KEYS[2], -1, -1, 'WITHSCORES')[2])
+	local ready = last + tonumber(ARGV[2 + math.min(n, #ARGV - 2)])
+	if ready > now then
+		return {2, ready - now}
+	end
+end
+
+redis.call('ZADD', KEYS[2], string.format('%.0f', now), ARGV[2])
+redis.call('PEXPIRE', KEYS[2], window)
+return {0, n + 1}
+`)
+
+// ReserveLoginAttempt counts a login attempt as username as failed, unless the account is locked
+// or the last failed login was too recent, in one step so that concurrent attempts are throttled
+// like consecutive ones. delays are how long to wait after the first, second and further failures
+// within window. Attempts which turn out right are to be released with ReleaseLoginAttempt.
+func (c *Cash) ReserveLoginAttempt(ctx context.Context, username string, window time.Duration, delays []time.Duration) (models.LoginAttempt, error) {
+	const op = "ReserveLoginAttempt"
+
+	// Unique members make attempts within the same millisecond all count
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	args := make([]interface{}, 0, len(delays)+2)
+	args = append(args, window.Milliseconds(), id)
+	for _, d := range delays {
+		args = append(args, d.Milliseconds())
+	}
+
+	res, err := reserveLoginScript.Run(ctx, c.client, []string{
+		accountLockKey(username),
+		loginFailuresKey(models.AccountLoginSubject(username)),
+	}, args...).Int64Slice()
+	if err != nil {
+		return models.LoginAttempt{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(res) != 2 {
+		return models.LoginAttempt{}, fmt.Errorf("%s: unexpected reply %v", op, res)
+	}
+
+	switch res[0] {
+	case 1:
+		return models.LoginAttempt{LockedFor: time.Duration(res[1]) * time.Millisecond}, nil
+	case 2:
+		return models.LoginAttempt{RetryAfter: time.Duration(res[1]) * time.Millisecond}, nil
+	}
+
+	return models.LoginAttempt{ID: id, Failures: int(res[1])}, nil
+}
+
+// ReleaseLoginAttempt takes back the attempt id reserved by ReserveLoginAttempt,
+// which turned out right, keeping the failed logins before it
+func (c *Cash) ReleaseLoginAttempt(ctx context.Context, username, id string) error {
+	const op = "ReleaseLoginAttempt"
+
+	err := c.client.ZRem(ctx, loginFailuresKey(models.AccountLoginSubject(username)), id).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// LoginFailures returns the times of the failed logins of subject within the last
+// window, oldest first.
+func (c *Cash) LoginFailures(ctx context.Context, subject string, window time.Duration) ([]time.Time, error) {
+	const op = "LoginFailures"
+
+	since := time.Now().Add(-window)
+
+	entries, err := c.client.ZRangeByScoreWithScores(ctx, loginFailuresKey(subject), &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	failures := make([]time.Time, 0, len(entries))
+	for _, e := range entries {
+		failures = append(failures, time.UnixMilli(int64(e.Score)))
+	}
+
+	return failures, nil
+}
+
+// AddLoginFailure records a failed login of subject and returns the number of
+// failures within the last window, this one included. Older ones are dropped.
+func (c *Cash) AddLoginFailure(ctx context.Context, subject string, window time.Duration) (int, error) {
+	const op = "AddLoginFailure"
+
+	key := loginFailuresKey(subject)
+	now := time.Now()
+
+	var count *redis.IntCmd
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(now.Add(-window).UnixMilli(), 10))
+		// Members are unique so that failures within the same millisecond are all counted
+		pipe.ZAdd(ctx, key, redis.Z{
+			Score:  float64(now.UnixMilli()),
+			Member: strconv.FormatInt(now.UnixNano(), 10),
+		})
+		count = pipe.ZCard(ctx, key)
+		pipe.Expire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(count.Val()), nil
+}
+
+// ResetLoginFailures forgets the failed logins of subject
+func (c *Cash) ResetLoginFailures(ctx context.Context, subject string) error {
+	const op = "ResetLoginFailures"
+
+	err := c.client.Del(ctx, loginFailuresKey(subject)).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// LockAccount rejects logins as username for ttl
+func (c *Cash) LockAccount(ctx context.Context, username string, ttl time.Duration) error {
+	const op = "LockAccount"
+
+	err := c.client.Set(ctx, accountLockKey(username), 1, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UnlockAccount lifts the lock on username along with its failed logins,
+// so that the user is not locked again right away
+func (c *Cash) UnlockAccount(ctx context.Context, username string) error {
+	const op = "UnlockAccount"
+
+	err := c.client.Del(ctx, accountLockKey(username), loginFailuresKey(models.AccountLoginSubject(username))).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func loginFailuresKey(subject string) string {
+	return "login-failures:" + subject
+}
+
+func accountLockKey(username string) string {
+	return "account-lock:" + username
+}
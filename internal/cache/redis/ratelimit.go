@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript applies the generic cell rate algorithm to the theoretical arrival time
+// kept in KEYS[1], in microseconds of the Redis clock so that replicas agree on it.
+// ARGV[1] is the emission interval and ARGV[2] the burst tolerance, in microseconds.
+// It returns whether the request is allowed and how far ahead of now the arrival time is.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local tat = redis.call('GET', KEYS[1])
+if tat then
+	tat = math.max(tonumber(tat), now)
+else
+	tat = now
+end
+
+local new_tat = tat + interval
+if new_tat - now > tolerance then
+	return {0, tat - now}
+end
+
+redis.call('SET', KEYS[1], string.format('%.0f', new_tat), 'PX', math.ceil((new_tat - now) / 1000))
+return {1, new_tat - now}
+`)
+
+// GCRA lets a request of key through when no more than burst requests were let
+// through within the last burst intervals. It returns whether the request is allowed
+// and how long it takes for the key to be allowed a full burst again.
+func (c *Cash) GCRA(ctx context.Context, key string, interval time.Duration, burst int) (bool, time.Duration, error) {
+	const op = "GCRA"
+
+	res, err := gcraScript.Run(ctx, c.client, []string{rateLimitKey(key)},
+		interval.Microseconds(),
+		interval.Microseconds()*int64(burst),
+	).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("%s: unexpected reply %v", op, res)
+	}
+
+	return res[0] == 1, time.Duration(res[1]) * time.Microsecond, nil
+}
+
+func rateLimitKey(key string) string {
+	return "rate-limit:" + key
+}
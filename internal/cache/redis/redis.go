@@ -2,13 +2,22 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"user-management-service/internal/config"
+	"user-management-service/internal/lib/jwt"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// legacyBlacklistKey is the set revoked tokens were once kept in, forever
+const legacyBlacklistKey = "blacklist"
+
+// drainBatchSize is the number of legacy entries moved per round trip
+const drainBatchSize = 500
+
 type Cash struct {
 	client *redis.Client
 }
@@ -17,6 +26,8 @@ func New(cfg config.Cache) (*Cash, error) {
 	client := redis.NewClient(&redis.Options{
 		Addr: fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
 		DB:   cfg.DB,
+		// Without it the deadlines of contexts only bound the wait for a connection
+		ContextTimeoutEnabled: true,
 	})
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -27,18 +38,66 @@ func New(cfg config.Cache) (*Cash, error) {
 		return nil, err
 	}
 
-	err = client.SAdd(ctx, "blacklist", "").Err()
+	return &Cash{client: client}, nil
+}
+
+// RevokeToken revokes the token with id for ttl, which should be its remaining lifetime.
+// It reports whether the token was not revoked before, so that single use tokens
+// can be consumed atomically.
+func (c *Cash) RevokeToken(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	const op = "RevokeToken"
+
+	if ttl <= 0 {
+		// The token is expired, nobody can use it anymore
+		return true, nil
+	}
+
+	ok, err := c.client.SetNX(ctx, revokedTokenKey(id), 1, ttl).Result()
 	if err != nil {
-		return nil, err
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &Cash{client: client}, nil
+	return ok, nil
+}
+
+// RevokeTokens revokes every token in one round trip, each for its own ttl.
+func (c *Cash) RevokeTokens(ctx context.Context, tokens map[string]time.Duration) error {
+	const op = "RevokeTokens"
+
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for id, ttl := range tokens {
+			if ttl <= 0 {
+				continue
+			}
+			pipe.Set(ctx, revokedTokenKey(id), 1, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// IsTokenRevoked reports whether the token with id is revoked.
+func (c *Cash) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	const op = "IsTokenRevoked"
+
+	n, err := c.client.Exists(ctx, revokedTokenKey(id)).Result()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return n > 0, nil
 }
 
-func (c *Cash) AddToBlaclist(ctx context.Context, token string) error {
-	const op = "SearchInBlacklist"
+// RevokeSessionTokens revokes the access tokens issued for the session sid.
+// The mark is kept for ttl, after which all such tokens are expired anyway.
+func (c *Cash) RevokeSessionTokens(ctx context.Context, sid string, ttl time.Duration) error {
+	const op = "RevokeSessionTokens"
 
-	err := c.client.SAdd(ctx, "blacklist", token).Err()
+	err := c.client.Set(ctx, revokedSessionKey(sid), 1, ttl).Err()
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -46,13 +105,97 @@ func (c *Cash) AddToBlaclist(ctx context.Context, token string) error {
 	return nil
 }
 
-func (c *Cash) SearchInBlacklist(ctx context.Context, token string) (bool, error) {
-	const op = "SearchInBlacklist"
+// IsSessionRevoked reports whether the access tokens of the session sid are revoked.
+func (c *Cash) IsSessionRevoked(ctx context.Context, sid string) (bool, error) {
+	const op = "IsSessionRevoked"
 
-	found, err := c.client.SIsMember(ctx, "blacklist", token).Result()
+	n, err := c.client.Exists(ctx, revokedSessionKey(sid)).Result()
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return found, nil
+	return n > 0, nil
+}
+
+// DrainLegacyBlacklist moves the tokens of the legacy blacklist set to expiring
+// entries, keyed by the hash of the token, and deletes the set. The entries are
+// kept for ttl, the longest lifetime any of those tokens may have left.
+func (c *Cash) DrainLegacyBlacklist(ctx context.Context, ttl time.Duration) (int, error) {
+	const op = "DrainLegacyBlacklist"
+
+	var drained int
+	for {
+		// Popping takes the members out of the set, so no member is missed or moved twice
+		tokens, err := c.client.SPopN(ctx, legacyBlacklistKey, drainBatchSize).Result()
+		if err != nil {
+			return drained, fmt.Errorf("%s: %w", op, err)
+		}
+		if len(tokens) == 0 {
+			break
+		}
+
+		_, err = c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, token := range tokens {
+				if token != "" {
+					pipe.Set(ctx, revokedTokenKey(jwt.LegacyID(token)), 1, ttl)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			// Put the popped tokens back, not to forget they are revoked
+			members := make([]interface{}, len(tokens))
+			for i, token := range tokens {
+				members[i] = token
+			}
+			c.client.SAdd(context.WithoutCancel(ctx), legacyBlacklistKey, members...)
+
+			return drained, fmt.Errorf("%s: %w", op, err)
+		}
+
+		drained += len(tokens)
+	}
+
+	return drained, nil
+}
+
+// RevokeUserTokens revokes every token of the user issued up to now, to the millisecond.
+// The mark is kept for ttl, after which all such tokens are expired anyway.
+func (c *Cash) RevokeUserTokens(ctx context.Context, uuid string, ttl time.Duration) error {
+	const op = "RevokeUserTokens"
+
+	err := c.client.Set(ctx, revokedBeforeKey(uuid), time.Now().UnixMilli(), ttl).Err()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UserTokensRevokedAt returns the time the user's tokens were last revoked at,
+// or zero time if they never were.
+func (c *Cash) UserTokensRevokedAt(ctx context.Context, uuid string) (time.Time, error) {
+	const op = "UserTokensRevokedAt"
+
+	ms, err := c.client.Get(ctx, revokedBeforeKey(uuid)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return time.UnixMilli(ms), nil
+}
+
+func revokedTokenKey(id string) string {
+	return "revoked-token:" + id
+}
+
+func revokedSessionKey(sid string) string {
+	return "revoked-session:" + sid
+}
+
+func revokedBeforeKey(uuid string) string {
+	return "revoked-before:" + uuid
 }
@@ -1,7 +1,12 @@
 package config
 
 import (
+	"encoding/base64"
+	"fmt"
 	"log"
+	"net/netip"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -14,6 +19,10 @@ type Config struct {
 	Cache
 	Broker
 	Token
+	Auth
+	OAuth
+	RateLimit
+	Deadlines
 	HTTPServer
 }
 
@@ -22,6 +31,9 @@ type HTTPServer struct {
 	Timeout         time.Duration `envconfig:"SERVER_TIMEOUT"`
 	IdleTimeout     time.Duration `envconfig:"SERVER_IDLE_TIMEOUT"`
 	ShutdownTimeout time.Duration `envconfig:"SERVER_SHUTDOWN_TIMEOUT"`
+	// TrustedProxies are the networks of the proxies whose X-Forwarded-For is
+	// believed, as comma separated CIDRs. Requests are seen from their peer otherwise.
+	TrustedProxies []netip.Prefix `envconfig:"SERVER_TRUSTED_PROXIES"`
 }
 
 type Storage struct {
@@ -40,18 +52,168 @@ type Cache struct {
 }
 
 type Broker struct {
-	URL       string `envconfig:"BROKER_URL"`
-	QueueName string `envconfig:"QUEUE_NAME"`
+	URL                   string `envconfig:"BROKER_URL"`
+	QueueName             string `envconfig:"QUEUE_NAME"`
+	VerificationQueueName string `envconfig:"VERIFICATION_QUEUE_NAME" default:"verify-email-stream"`
+	SecurityQueueName     string `envconfig:"SECURITY_EVENTS_QUEUE_NAME" default:"security-events"`
 }
 
 type Token struct {
 	JWT struct {
-		Secret string        `envconfig:"JWT_TOKEN_SECRET"`
-		TTL    time.Duration `envconfig:"JWT_TOKEN_TTL"`
+		TTL time.Duration `envconfig:"JWT_TOKEN_TTL"`
+		// Algorithm is one of RS256, ES256 or EdDSA
+		Algorithm string `envconfig:"JWT_SIGNING_ALG" default:"ES256"`
+		// RotationPeriod is how long a key signs tokens before it is replaced
+		RotationPeriod time.Duration `envconfig:"JWT_KEY_ROTATION_PERIOD" default:"720h"`
+		// ReloadInterval is how often keys rotated by other replicas are picked up
+		ReloadInterval time.Duration `envconfig:"JWT_KEY_RELOAD_INTERVAL" default:"1m"`
+		// GroupsClaim puts the names of the user's groups in access tokens
+		GroupsClaim bool `envconfig:"JWT_GROUPS_CLAIM" default:"false"`
+		// KeyEncryptionKey seals the private signing keys stored in the database,
+		// whoever reads them could sign tokens otherwise
+		KeyEncryptionKey EncryptionKey `envconfig:"JWT_KEY_ENCRYPTION_KEY" required:"true"`
 	}
 	Refresh struct {
 		TTL time.Duration `envconfig:"REFRESH_TOKEN_TTL"`
 	}
+	Verification struct {
+		TTL time.Duration `envconfig:"EMAIL_VERIFICATION_TOKEN_TTL" default:"24h"`
+	}
+	Reset struct {
+		TTL time.Duration `envconfig:"PASSWORD_RESET_TOKEN_TTL" default:"1h"`
+	}
+	MFA struct {
+		TTL time.Duration `envconfig:"MFA_CHALLENGE_TOKEN_TTL" default:"5m"`
+	}
+}
+
+type Auth struct {
+	// RequireVerifiedEmail blocks Login until the user has confirmed their email
+	RequireVerifiedEmail bool `envconfig:"AUTH_REQUIRE_VERIFIED_EMAIL" default:"false"`
+	// MFARequiredRoles are only granted to users with TOTP enrolled,
+	// the others get the plain user role in their tokens
+	MFARequiredRoles []string `envconfig:"AUTH_MFA_REQUIRED_ROLES" default:"moderator,admin"`
+	// MFAIssuer is the account issuer shown in authenticator apps
+	MFAIssuer string `envconfig:"AUTH_MFA_ISSUER" default:"user-management-service"`
+	// RevocationCacheTTL is how long a replica trusts what it learned about
+	// revoked access tokens, which delays revocations by as much
+	RevocationCacheTTL time.Duration `envconfig:"AUTH_REVOCATION_CACHE_TTL" default:"5s"`
+	// RevocationCacheSize bounds the number of cached answers
+	RevocationCacheSize int `envconfig:"AUTH_REVOCATION_CACHE_SIZE" default:"10000"`
+	// LoginFailureWindow is how long failed logins are counted for
+	LoginFailureWindow time.Duration `envconfig:"AUTH_LOGIN_FAILURE_WINDOW" default:"15m"`
+	// MaxLoginFailures failed logins as one user within the window lock
+	// the account for LoginLockout, zero disables the lockout
+	MaxLoginFailures int           `envconfig:"AUTH_MAX_LOGIN_FAILURES" default:"5"`
+	LoginLockout     time.Duration `envconfig:"AUTH_LOGIN_LOCKOUT" default:"15m"`
+	// MaxIPLoginFailures failed logins from one address within the window
+	// reject its further attempts, zero disables the limit
+	MaxIPLoginFailures int `envconfig:"AUTH_MAX_IP_LOGIN_FAILURES" default:"50"`
+	// LoginDelay is how long a user waits after a failed login before trying
+	// again, doubled by every further failure up to MaxLoginDelay
+	LoginDelay    time.Duration `envconfig:"AUTH_LOGIN_DELAY" default:"1s"`
+	MaxLoginDelay time.Duration `envconfig:"AUTH_MAX_LOGIN_DELAY" default:"30s"`
+}
+
+type OAuth struct {
+	// Issuer is the URL the service is reachable at, identifying it in ID tokens
+	Issuer string `envconfig:"OAUTH_ISSUER" default:"http://localhost:8080"`
+	// CodeTTL is how long an authorization code may be exchanged for tokens
+	CodeTTL time.Duration `envconfig:"OAUTH_CODE_TTL" default:"1m"`
+}
+
+type RateLimit struct {
+	Enabled bool `envconfig:"RATE_LIMIT_ENABLED" default:"true"`
+	// Limits of anonymous routes are counted per client address
+	Signup        Rate `envconfig:"RATE_LIMIT_SIGNUP" default:"5/1h"`
+	Login         Rate `envconfig:"RATE_LIMIT_LOGIN" default:"30/1m"`
+	ResetPassword Rate `envconfig:"RATE_LIMIT_RESET_PASSWORD" default:"5/1h"`
+	Token         Rate `envconfig:"RATE_LIMIT_TOKEN" default:"60/1m"`
+	// API is the limit of routes requiring an access token, counted per
+	// personal access token, or else per principal
+	API Rate `envconfig:"RATE_LIMIT_API" default:"600/1m"`
+	// StoreTimeout bounds the wait for Redis, after which limits are counted in memory
+	StoreTimeout time.Duration `envconfig:"RATE_LIMIT_STORE_TIMEOUT" default:"100ms"`
+	// FallbackSize bounds the number of keys counted in memory
+	FallbackSize int `envconfig:"RATE_LIMIT_FALLBACK_SIZE" default:"100000"`
+}
+
+// Deadlines bound how long service operations may run, however long the client
+// is willing to wait. Operations are named after their op without the service.
+// prefix, such as auth.Login, and default to OperationTimeout.
+type Deadlines struct {
+	OperationTimeout  time.Duration            `envconfig:"OPERATION_TIMEOUT" default:"5s"`
+	OperationTimeouts map[string]time.Duration `envconfig:"OPERATION_TIMEOUTS" default:"auth.SignUp:10s,auth.Login:10s,auth.ConfirmResetPassword:10s,user.ListUsers:10s"`
+}
+
+// For returns the deadline of the operation op, as "service.auth.Login" or "auth.Login"
+func (d Deadlines) For(op string) time.Duration {
+	if timeout, ok := d.OperationTimeouts[strings.TrimPrefix(op, "service.")]; ok {
+		return timeout
+	}
+
+	return d.OperationTimeout
+}
+
+// Rate is a number of requests per period, written as 5/1h or 5/h.
+// The requests may come in a burst. Empty or zero rates disable the limit.
+type Rate struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Decode implements envconfig.Decoder
+func (r *Rate) Decode(value string) error {
+	if value == "" {
+		*r = Rate{}
+		return nil
+	}
+
+	requests, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return fmt.Errorf("rate %q is not <requests>/<period>", value)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid number of requests in rate %q", value)
+	}
+
+	// A bare unit is one of it
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid period in rate %q", value)
+	}
+
+	*r = Rate{Requests: n, Period: d}
+
+	return nil
+}
+
+// EncryptionKey is a 32 byte AES-256 key, written in standard base64
+type EncryptionKey []byte
+
+// Decode implements envconfig.Decoder
+func (k *EncryptionKey) Decode(value string) error {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf("encryption key is not base64: %w", err)
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("encryption key is %d bytes, want 32", len(key))
+	}
+
+	*k = key
+
+	return nil
+}
+
+// String keeps the key out of logs and error messages
+func (k EncryptionKey) String() string {
+	return "[REDACTED]"
 }
 
 func MustLoad() *Config {
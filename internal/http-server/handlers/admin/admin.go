@@ -0,0 +1,326 @@
+package admin
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"user-management-service/internal/http-server/middleware/auth"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/rbac"
+	"user-management-service/internal/lib/request"
+	resp "user-management-service/internal/lib/response"
+	"user-management-service/internal/models"
+	service "user-management-service/internal/service/user"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+type Service interface {
+	ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, string, error)
+	UserByUUID(ctx context.Context, uuid string) (*models.User, error)
+	UpdateUser(ctx context.Context, uuid string, patch models.UserPatch) (*models.User, error)
+	Block(ctx context.Context, uuid, moderator, role, reason string, until *time.Time) (*models.User, error)
+	Unblock(ctx context.Context, uuid, role string) (*models.User, error)
+	Unlock(ctx context.Context, uuid, role string) (*models.User, error)
+	Delete(ctx context.Context, uuid string) error
+}
+
+// errs are the errors of the service clients are told about
+var errs = resp.ErrorMap{
+	{Err: service.ErrUserNotFound, Status: http.StatusNotFound, Code: resp.CodeUserNotFound},
+	{Err: service.ErrUserExists, Status: http.StatusConflict, Code: resp.CodeUsernameTaken, Detail: "username is taken"},
+	{Err: service.ErrInvalidRole, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "role"},
+	{Err: service.ErrNoFieldsToUpdate, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed},
+	{Err: service.ErrCannotBlockSelf, Status: http.StatusForbidden, Code: resp.CodeForbidden, Detail: "can't block yourself"},
+	{Err: service.ErrOutranked, Status: http.StatusForbidden, Code: resp.CodeForbidden},
+	{Err: service.ErrInvalidBlockEnd, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "until"},
+}
+
+// listErrs are of the query string
+var listErrs = resp.ErrorMap{
+	{Err: service.ErrInvalidFilter, Status: http.StatusBadRequest, Code: resp.CodeInvalidRequest, Detail: "invalid filter"},
+	{Err: service.ErrInvalidRole, Status: http.StatusBadRequest, Code: resp.CodeInvalidRequest, Detail: "invalid filter"},
+	{Err: service.ErrInvalidCursor, Status: http.StatusBadRequest, Code: resp.CodeInvalidRequest},
+}
+
+type Handler struct {
+	log     *slog.Logger
+	service Service
+}
+
+func New(log *slog.Logger, service Service) *Handler {
+	return &Handler{
+		log:     log,
+		service: service,
+	}
+}
+
+func (h *Handler) Register() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.With(auth.RequirePermission(rbac.UsersRead)).Get("/users", h.list)
+		r.With(auth.RequirePermission(rbac.UsersRead)).Get("/users/{uuid}", h.get)
+		r.With(auth.RequirePermission(rbac.UsersWrite)).Patch("/users/{uuid}", h.patch)
+		r.With(auth.RequirePermission(rbac.UsersDelete)).Delete("/users/{uuid}", h.delete)
+		r.With(auth.RequirePermission(rbac.UsersBlock)).Post("/users/{uuid}/block", h.block)
+		r.With(auth.RequirePermission(rbac.UsersBlock)).Delete("/users/{uuid}/block", h.unblock)
+		r.With(auth.RequirePermission(rbac.UsersBlock)).Delete("/users/{uuid}/lockout", h.unlock)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.admin.list"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		log.Debug("invalid filter", sl.Error(err))
+		resp.BadRequest(w, r, "invalid filter")
+		return
+	}
+
+	users, next, err := h.service.ListUsers(r.Context(), filter)
+	if err != nil {
+		log.Error("failed to list users", sl.Error(err))
+		listErrs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.UserList{
+		Users:      resp.NewAdminUsers(users),
+		NextCursor: next,
+	})
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.admin.get"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	uuid, ok := userParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.service.UserByUUID(r.Context(), uuid)
+	if err != nil {
+		log.Error("failed to get user", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.NewAdminUser(user))
+}
+
+func (h *Handler) patch(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.admin.patch"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	uuid, ok := userParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req request.UpdateUser
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	user, err := h.service.UpdateUser(r.Context(), uuid, models.UserPatch{
+		Name:        req.Name,
+		Surname:     req.Surname,
+		Username:    req.Username,
+		PhoneNumber: req.PhoneNumber,
+		Email:       req.Email,
+		Role:        req.Role,
+	})
+	if err != nil {
+		log.Error("failed to update user", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.NewAdminUser(user))
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.admin.delete"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	uuid, ok := userParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.Delete(r.Context(), uuid)
+	if err != nil {
+		log.Error("failed to delete user", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
+
+func (h *Handler) block(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.admin.block"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to block user: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	uuid, ok := userParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req request.BlockUser
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	// Only users are recorded as moderators, blocks by service accounts have none
+	var moderator string
+	if principal.Type == models.PrincipalUser {
+		moderator = principal.UUID
+	}
+
+	user, err := h.service.Block(r.Context(), uuid, moderator, principal.Role, req.Reason, req.Until)
+	if err != nil {
+		log.Error("failed to block user", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.NewAdminUser(user))
+}
+
+func (h *Handler) unblock(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.admin.unblock"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to unblock user: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	uuid, ok := userParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.service.Unblock(r.Context(), uuid, principal.Role)
+	if err != nil {
+		log.Error("failed to unblock user", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.NewAdminUser(user))
+}
+
+func (h *Handler) unlock(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.admin.unlock"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to unlock user: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	uuid, ok := userParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.service.Unlock(r.Context(), uuid, principal.Role)
+	if err != nil {
+		log.Error("failed to unlock user", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.NewAdminUser(user))
+}
+
+// userParam returns the uuid of the user the route is about, ids which can't be one are not found
+func userParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	uuid, ok := request.UUIDParam(r, "uuid")
+	if !ok {
+		errs.Render(w, r, service.ErrUserNotFound)
+	}
+
+	return uuid, ok
+}
+
+// parseFilter reads the list filter from the query string
+func parseFilter(r *http.Request) (models.UserFilter, error) {
+	q := r.URL.Query()
+
+	filter := models.UserFilter{
+		Role:     q.Get("role"),
+		Email:    q.Get("email"),
+		Username: q.Get("username"),
+		Sort:     q.Get("sort"),
+		Order:    q.Get("order"),
+		Cursor:   q.Get("cursor"),
+	}
+
+	if v := q.Get("blocked"); v != "" {
+		blocked, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.Blocked = &blocked
+	}
+
+	if v := q.Get("created_after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, err
+		}
+		filter.CreatedAfter = &t
+	}
+
+	if v := q.Get("created_before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, err
+		}
+		filter.CreatedBefore = &t
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
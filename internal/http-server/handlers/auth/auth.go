@@ -1,12 +1,18 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 
 	"user-management-service/internal/config"
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/logger"
 	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/request"
 	resp "user-management-service/internal/lib/response"
 	"user-management-service/internal/models"
 	service "user-management-service/internal/service/auth"
@@ -16,12 +22,44 @@ import (
 )
 
 type Service interface {
-	SignUp(username, email, password string) error
-	Login(username, password string) (string, string, error)
-	RefreshToken(token string) (string, string, error)
-	ResetPassword(email string) error
+	SignUp(ctx context.Context, username, email, password string) error
+	Login(ctx context.Context, username, password string, client models.Client) (string, string, error)
+	LoginMFA(ctx context.Context, token, code string, client models.Client) (string, string, error)
+	RefreshToken(ctx context.Context, token string, client models.Client) (string, string, error)
+	Logout(ctx context.Context, token string) error
+	LogoutAll(ctx context.Context, token string) error
+	ResetPassword(ctx context.Context, email string) error
+	ConfirmResetPassword(ctx context.Context, token, password string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
 }
 
+// errs are the errors of the service clients are told about
+var errs = resp.ErrorMap{
+	{Err: service.ErrUserExists, Status: http.StatusConflict, Code: resp.CodeUserExists},
+	// Expired tokens are invalid too, but clients are to tell them apart, as in the auth middleware
+	{Err: jwt.ErrTokenExpired, Status: http.StatusUnauthorized, Code: resp.CodeTokenExpired},
+	{Err: service.ErrInvalidToken, Status: http.StatusUnauthorized, Code: resp.CodeInvalidToken},
+	// Reuse of a refresh token is not to be told apart from its revocation
+	{Err: service.ErrTokenReused, Status: http.StatusUnauthorized, Code: resp.CodeTokenRevoked, Detail: "token revoked"},
+	{Err: service.ErrTokenRevoked, Status: http.StatusUnauthorized, Code: resp.CodeTokenRevoked},
+	{Err: service.ErrInvalidMFACode, Status: http.StatusUnauthorized, Code: resp.CodeInvalidMFACode},
+	{Err: service.ErrUserBlocked, Status: http.StatusForbidden, Code: resp.CodeUserBlocked},
+	{Err: service.ErrEmailNotVerified, Status: http.StatusForbidden, Code: resp.CodeEmailNotVerified},
+	{Err: service.ErrEmailAlreadyVerified, Status: http.StatusConflict, Code: resp.CodeEmailAlreadyVerified},
+}
+
+// loginErrs don't tell unknown usernames from wrong passwords
+var loginErrs = append(resp.ErrorMap{
+	{Err: service.ErrUserNotFound, Status: http.StatusUnauthorized, Code: resp.CodeInvalidCredentials, Detail: "invalid credentials"},
+	{Err: service.ErrInvalidCredentials, Status: http.StatusUnauthorized, Code: resp.CodeInvalidCredentials},
+}, errs...)
+
+// linkErrs are of the single use tokens sent by email, which are not credentials
+var linkErrs = append(resp.ErrorMap{
+	{Err: service.ErrInvalidToken, Status: http.StatusBadRequest, Code: resp.CodeInvalidToken, Detail: "invalid or expired token"},
+}, errs...)
+
 type Handler struct {
 	log      *slog.Logger
 	service  Service
@@ -40,38 +78,34 @@ func (h *Handler) Register() func(r chi.Router) {
 	return func(r chi.Router) {
 		r.Post("/signup", h.signup)
 		r.Post("/login", h.login)
+		r.Post("/login/mfa", h.loginMFA)
 		r.Post("/refresh-token", h.refreshToken)
+		r.Post("/logout", h.logout)
+		r.Post("/logout-all", h.logoutAll)
 		r.Post("/reset-password", h.resetPassword)
+		r.Post("/reset-password/confirm", h.confirmResetPassword)
+		r.Post("/verify-email", h.verifyEmail)
+		r.Post("/resend-verification", h.resendVerification)
 	}
 }
 
 func (h *Handler) signup(w http.ResponseWriter, r *http.Request) {
 	const op = "handlers.auth.signup"
 
-	log := h.log.With(slog.String("op", op))
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
 
-	var user models.User
-	err := render.DecodeJSON(r.Body, &user)
+	var req request.SignUp
+	err := request.Decode(w, r, &req)
 	if err != nil {
-		log.Error("failed to signup user", sl.Error(err))
-		render.JSON(w, r, resp.Err("internal error"))
-		return
-	}
-
-	if user.Username == "" || user.Password == "" || user.Email == "" {
-		log.Debug("failed to signup user: invalid credentials")
-		render.JSON(w, r, resp.Err("invalid credentials"))
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
 		return
 	}
 
-	err = h.service.SignUp(user.Username, user.Email, user.Password)
+	err = h.service.SignUp(r.Context(), req.Username, req.Email, req.Password)
 	if err != nil {
 		log.Debug("failed to signup user", sl.Error(err))
-		if errors.As(err, &service.ErrUserExists) {
-			render.JSON(w, r, resp.Err("user already exists"))
-			return
-		}
-		render.JSON(w, r, resp.Err("internal error"))
+		errs.Render(w, r, err)
 		return
 	}
 
@@ -81,27 +115,42 @@ func (h *Handler) signup(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 	const op = "handlers.auth.login"
 
-	log := h.log.With(slog.String("op", op))
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
 
-	var user models.User
-	render.DecodeJSON(r.Body, &user)
-
-	// Validation
-	if user.Username == "" && user.Password == "" {
-		log.Debug("invalid credentials")
-		render.JSON(w, r, resp.Err("invalid credentials"))
+	var req request.Login
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
 		return
 	}
 
 	// Login user
-	accessToken, refreshToken, err := h.service.Login(user.Username, user.Password)
+	accessToken, refreshToken, err := h.service.Login(r.Context(), req.Username, req.Password, request.Client(r))
 	if err != nil {
-		log.Error("failed to login user", sl.Error(err))
-		if errors.As(err, &service.ErrUserNotFound) {
-			render.JSON(w, r, resp.Err("user not found"))
+		var mfaErr *service.MFARequiredError
+		if errors.As(err, &mfaErr) {
+			log.Debug("second factor required")
+			render.JSON(w, r, resp.MFAChallenge{
+				MFARequired: true,
+				MFAToken:    mfaErr.Token,
+			})
+			return
+		}
+
+		var throttledErr *service.ThrottledError
+		if errors.As(err, &throttledErr) {
+			log.Info("login throttled", slog.String("username", req.Username), sl.Error(err))
+			renderThrottled(w, r, throttledErr)
 			return
 		}
-		render.JSON(w, r, resp.Err("internal error"))
+
+		if loginErrs.Has(err) {
+			log.Info("failed to login user", sl.Error(err))
+		} else {
+			log.Error("failed to login user", sl.Error(err))
+		}
+		loginErrs.Render(w, r, err)
 		return
 	}
 
@@ -112,31 +161,72 @@ func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *Handler) refreshToken(w http.ResponseWriter, r *http.Request) {
-	const op = "handlers.auth.refreshToken"
+func (h *Handler) loginMFA(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.auth.loginMFA"
 
-	log := h.log.With(slog.String("op", op))
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
 
-	type RefreshTokenRequest struct {
-		Token string `json:"refreshToken"`
+	var req request.LoginMFA
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
 	}
 
-	var oldRefreshToken RefreshTokenRequest
-	err := render.DecodeJSON(r.Body, &oldRefreshToken)
+	accessToken, refreshToken, err := h.service.LoginMFA(r.Context(), req.Token, req.Code, request.Client(r))
 	if err != nil {
-		log.Debug("failed to refresh tokens", sl.Error(err))
-		render.JSON(w, r, resp.Err("internal error"))
+		var throttledErr *service.ThrottledError
+		if errors.As(err, &throttledErr) {
+			log.Info("login throttled", sl.Error(err))
+			renderThrottled(w, r, throttledErr)
+			return
+		}
+
+		if errs.Has(err) {
+			log.Info("failed to login user", sl.Error(err))
+		} else {
+			log.Error("failed to login user", sl.Error(err))
+		}
+		errs.Render(w, r, err)
 		return
 	}
 
-	accessToken, refreshToken, err := h.service.RefreshToken(oldRefreshToken.Token)
+	render.JSON(w, r, resp.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	})
+}
+
+// renderThrottled answers a login rejected before its credentials were checked
+func renderThrottled(w http.ResponseWriter, r *http.Request, err *service.ThrottledError) {
+	// Whole seconds, rounded up not to invite a retry that is rejected again
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+
+	code := resp.CodeTooManyRequests
+	if errors.Is(err, service.ErrAccountLocked) {
+		code = resp.CodeAccountLocked
+	}
+	resp.Error(w, r, http.StatusTooManyRequests, code, err.Err.Error())
+}
+
+func (h *Handler) refreshToken(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.auth.refreshToken"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	var req request.RefreshToken
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	accessToken, refreshToken, err := h.service.RefreshToken(r.Context(), req.Token, request.Client(r))
 	if err != nil {
 		log.Error("failed to refresh tokens", sl.Error(err))
-		if errors.As(err, &service.ErrTokenRevoked) {
-			render.JSON(w, r, resp.Err("token revoked"))
-			return
-		}
-		render.JSON(w, r, resp.Err("internal error"))
+		errs.Render(w, r, err)
 		return
 	}
 
@@ -146,32 +236,138 @@ func (h *Handler) refreshToken(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.auth.logout"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	var req request.RefreshToken
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	err = h.service.Logout(r.Context(), req.Token)
+	if err != nil {
+		log.Error("failed to logout", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
+
+func (h *Handler) logoutAll(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.auth.logoutAll"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	var req request.RefreshToken
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	err = h.service.LogoutAll(r.Context(), req.Token)
+	if err != nil {
+		log.Error("failed to logout", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
+
 func (h *Handler) resetPassword(w http.ResponseWriter, r *http.Request) {
 	const op = "handlers.auth.resetPassword"
 
-	log := h.log.With(slog.String("op", op))
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
 
-	var user models.User
-	err := render.DecodeJSON(r.Body, &user)
+	var req request.Email
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	err = h.service.ResetPassword(r.Context(), req.Email)
 	if err != nil {
 		log.Error("failed to reset password", sl.Error(err))
-		render.JSON(w, r, resp.Err("internal error"))
+		errs.Render(w, r, err)
 		return
 	}
 
-	if user.Email == "" {
-		log.Debug("invalid credentials")
-		render.JSON(w, r, resp.Err("invalid credentials"))
+	render.JSON(w, r, resp.Ok())
+}
+
+func (h *Handler) confirmResetPassword(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.auth.confirmResetPassword"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	var req request.ConfirmResetPassword
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
 	}
 
-	err = h.service.ResetPassword(user.Email)
+	err = h.service.ConfirmResetPassword(r.Context(), req.Token, req.Password)
 	if err != nil {
 		log.Error("failed to reset password", sl.Error(err))
-		if errors.As(err, &service.ErrEmailNotFound) {
-			render.JSON(w, r, resp.Err("email not found"))
-			return
-		}
-		render.JSON(w, r, resp.Err("internal error"))
+		linkErrs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
+
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.auth.verifyEmail"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	var req request.VerifyEmail
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	err = h.service.VerifyEmail(r.Context(), req.Token)
+	if err != nil {
+		log.Error("failed to verify email", sl.Error(err))
+		linkErrs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
+
+func (h *Handler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.auth.resendVerification"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	var req request.Email
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	err = h.service.ResendVerification(r.Context(), req.Email)
+	if err != nil {
+		log.Error("failed to resend verification", sl.Error(err))
+		errs.Render(w, r, err)
 		return
 	}
 
@@ -0,0 +1,347 @@
+package group
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"user-management-service/internal/http-server/middleware/auth"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/rbac"
+	"user-management-service/internal/lib/request"
+	resp "user-management-service/internal/lib/response"
+	"user-management-service/internal/models"
+	service "user-management-service/internal/service/group"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+type Service interface {
+	Create(ctx context.Context, name, description string) (*models.Group, error)
+	Group(ctx context.Context, id string) (*models.Group, error)
+	List(ctx context.Context, member string, limit int, cursor string) ([]models.Group, string, error)
+	Update(ctx context.Context, id string, patch models.GroupPatch) (*models.Group, error)
+	Delete(ctx context.Context, id string) error
+	AddMember(ctx context.Context, groupID, uuid string) error
+	RemoveMember(ctx context.Context, groupID, uuid string) error
+	Members(ctx context.Context, groupID string, limit int, cursor string) ([]models.User, string, error)
+}
+
+// errs are the errors of the service clients are told about
+var errs = resp.ErrorMap{
+	{Err: service.ErrGroupNotFound, Status: http.StatusNotFound, Code: resp.CodeGroupNotFound},
+	{Err: service.ErrUserNotFound, Status: http.StatusNotFound, Code: resp.CodeUserNotFound},
+	{Err: service.ErrGroupExists, Status: http.StatusConflict, Code: resp.CodeGroupExists},
+	{Err: service.ErrAlreadyMember, Status: http.StatusConflict, Code: resp.CodeConflict},
+	{Err: service.ErrNotMember, Status: http.StatusNotFound, Code: resp.CodeNotFound},
+	{Err: service.ErrInvalidName, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "name"},
+	{Err: service.ErrNoFieldsToUpdate, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed},
+	{Err: service.ErrInvalidCursor, Status: http.StatusBadRequest, Code: resp.CodeInvalidRequest},
+}
+
+type Handler struct {
+	log     *slog.Logger
+	service Service
+}
+
+func New(log *slog.Logger, service Service) *Handler {
+	return &Handler{
+		log:     log,
+		service: service,
+	}
+}
+
+func (h *Handler) Register() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequirePermission(rbac.GroupsRead))
+
+			r.Get("/", h.list)
+			r.Get("/{id}", h.get)
+			r.Get("/{id}/members", h.members)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequirePermission(rbac.GroupsWrite))
+
+			r.Post("/", h.create)
+			r.Patch("/{id}", h.update)
+			r.Delete("/{id}", h.delete)
+			r.Put("/{id}/members/{uuid}", h.addMember)
+			r.Delete("/{id}/members/{uuid}", h.removeMember)
+		})
+	}
+}
+
+// RegisterMe registers the routes of the caller's own groups
+func (h *Handler) RegisterMe() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Use(auth.RequirePermission(rbac.MeRead))
+
+		r.Get("/", h.mine)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.group.list"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	member := r.URL.Query().Get("member")
+	if member != "" && !request.IsUUID(member) {
+		log.Debug("invalid member filter", slog.String("member", member))
+		resp.BadRequest(w, r, "invalid member")
+		return
+	}
+
+	h.renderList(w, r, log, member)
+}
+
+func (h *Handler) mine(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.group.mine"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to list groups: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	h.renderList(w, r, log, principal.UUID)
+}
+
+func (h *Handler) renderList(w http.ResponseWriter, r *http.Request, log *slog.Logger, member string) {
+	limit, cursor, err := page(r)
+	if err != nil {
+		log.Debug("invalid page", sl.Error(err))
+		resp.BadRequest(w, r, "invalid limit")
+		return
+	}
+
+	groups, next, err := h.service.List(r.Context(), member, limit, cursor)
+	if err != nil {
+		log.Error("failed to list groups", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	if groups == nil {
+		groups = []models.Group{}
+	}
+
+	render.JSON(w, r, resp.GroupList{
+		Groups:     groups,
+		NextCursor: next,
+	})
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.group.create"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	var req request.CreateGroup
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	group, err := h.service.Create(r.Context(), req.Name, req.Description)
+	if err != nil {
+		log.Error("failed to create group", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, group)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.group.get"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	id, ok := groupParam(w, r)
+	if !ok {
+		return
+	}
+
+	group, err := h.service.Group(r.Context(), id)
+	if err != nil {
+		log.Error("failed to get group", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, group)
+}
+
+func (h *Handler) update(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.group.update"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	id, ok := groupParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req request.UpdateGroup
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	group, err := h.service.Update(r.Context(), id, models.GroupPatch{
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		log.Error("failed to update group", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, group)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.group.delete"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	id, ok := groupParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.Delete(r.Context(), id)
+	if err != nil {
+		log.Error("failed to delete group", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
+
+func (h *Handler) members(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.group.members"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	id, ok := groupParam(w, r)
+	if !ok {
+		return
+	}
+
+	limit, cursor, err := page(r)
+	if err != nil {
+		log.Debug("invalid page", sl.Error(err))
+		resp.BadRequest(w, r, "invalid limit")
+		return
+	}
+
+	users, next, err := h.service.Members(r.Context(), id, limit, cursor)
+	if err != nil {
+		log.Error("failed to list group members", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.MemberList{
+		Users:      resp.NewPublicUsers(users),
+		NextCursor: next,
+	})
+}
+
+func (h *Handler) addMember(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.group.addMember"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	id, uuid, ok := memberParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.AddMember(r.Context(), id, uuid)
+	if err != nil {
+		log.Error("failed to add group member", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
+
+func (h *Handler) removeMember(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.group.removeMember"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	id, uuid, ok := memberParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.RemoveMember(r.Context(), id, uuid)
+	if err != nil {
+		log.Error("failed to remove group member", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
+
+// groupParam returns the id of the group the route is about, ids which can't be one are not found
+func groupParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id, ok := request.UUIDParam(r, "id")
+	if !ok {
+		errs.Render(w, r, service.ErrGroupNotFound)
+	}
+
+	return id, ok
+}
+
+// memberParams returns the ids of the group and of the user a membership route is about
+func memberParams(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	id, ok := groupParam(w, r)
+	if !ok {
+		return "", "", false
+	}
+
+	uuid, ok := request.UUIDParam(r, "uuid")
+	if !ok {
+		errs.Render(w, r, service.ErrUserNotFound)
+		return "", "", false
+	}
+
+	return id, uuid, true
+}
+
+// page reads the page size and cursor from the query string
+func page(r *http.Request) (int, string, error) {
+	q := r.URL.Query()
+
+	var limit int
+	if v := q.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	return limit, q.Get("cursor"), nil
+}
@@ -0,0 +1,20 @@
+package jwks
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"user-management-service/internal/lib/jwt"
+
+	"github.com/go-chi/render"
+)
+
+// Register serves the public keys tokens are verified with.
+// Consumers may cache the set for maxAge and should refetch it on an unknown kid.
+func Register(keys *jwt.KeySet, maxAge time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+		render.JSON(w, r, keys.JWKS())
+	}
+}
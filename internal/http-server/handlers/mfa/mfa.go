@@ -0,0 +1,178 @@
+package mfa
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"user-management-service/internal/http-server/middleware/auth"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/request"
+	resp "user-management-service/internal/lib/response"
+	service "user-management-service/internal/service/auth"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+type Service interface {
+	EnrollTOTP(ctx context.Context, uuid string) (string, string, error)
+	ConfirmTOTP(ctx context.Context, uuid, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, uuid, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, uuid, code string) ([]string, error)
+}
+
+// errs are the errors of the service clients are told about
+var errs = resp.ErrorMap{
+	{Err: service.ErrInvalidMFACode, Status: http.StatusUnprocessableEntity, Code: resp.CodeInvalidMFACode, Detail: "invalid code", Field: "code"},
+	{Err: service.ErrMFANotEnabled, Status: http.StatusConflict, Code: resp.CodeMFANotEnabled},
+	{Err: service.ErrMFAAlreadyEnabled, Status: http.StatusConflict, Code: resp.CodeMFAAlreadyEnabled},
+}
+
+// confirmErrs tell a missing enrollment apart, which is what a disabled mfa means on confirmation
+var confirmErrs = append(resp.ErrorMap{
+	{Err: service.ErrMFANotEnabled, Status: http.StatusConflict, Code: resp.CodeMFAEnrollmentMissing, Detail: "totp enrollment not started"},
+}, errs...)
+
+type Handler struct {
+	log     *slog.Logger
+	service Service
+}
+
+func New(log *slog.Logger, service Service) *Handler {
+	return &Handler{
+		log:     log,
+		service: service,
+	}
+}
+
+func (h *Handler) Register() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Use(auth.RejectPersonalTokens())
+
+		r.Post("/totp", h.enroll)
+		r.Post("/totp/confirm", h.confirm)
+		r.Delete("/totp", h.disable)
+		r.Post("/recovery-codes", h.regenerateRecoveryCodes)
+	}
+}
+
+func (h *Handler) enroll(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.mfa.enroll"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	uuid, ok := h.userUUID(w, r, log)
+	if !ok {
+		return
+	}
+
+	secret, uri, err := h.service.EnrollTOTP(r.Context(), uuid)
+	if err != nil {
+		log.Error("failed to enroll totp", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.TOTPEnrollment{
+		Secret: secret,
+		URI:    uri,
+	})
+}
+
+func (h *Handler) confirm(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.mfa.confirm"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	uuid, ok := h.userUUID(w, r, log)
+	if !ok {
+		return
+	}
+
+	var req request.MFACode
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	codes, err := h.service.ConfirmTOTP(r.Context(), uuid, req.Code)
+	if err != nil {
+		log.Error("failed to confirm totp", sl.Error(err))
+		confirmErrs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.RecoveryCodes{RecoveryCodes: codes})
+}
+
+func (h *Handler) disable(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.mfa.disable"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	uuid, ok := h.userUUID(w, r, log)
+	if !ok {
+		return
+	}
+
+	var req request.MFACode
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	err = h.service.DisableTOTP(r.Context(), uuid, req.Code)
+	if err != nil {
+		log.Error("failed to disable totp", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
+
+func (h *Handler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.mfa.regenerateRecoveryCodes"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	uuid, ok := h.userUUID(w, r, log)
+	if !ok {
+		return
+	}
+
+	var req request.MFACode
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(r.Context(), uuid, req.Code)
+	if err != nil {
+		log.Error("failed to regenerate recovery codes", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// userUUID retrieves the caller's id put in the request context by the auth middleware
+func (h *Handler) userUUID(w http.ResponseWriter, r *http.Request, log *slog.Logger) (string, bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("no principal in request context")
+		resp.Internal(w, r)
+		return "", false
+	}
+
+	return principal.UUID, true
+}
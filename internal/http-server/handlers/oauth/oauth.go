@@ -0,0 +1,440 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"user-management-service/internal/http-server/middleware/auth"
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/rbac"
+	"user-management-service/internal/lib/request"
+	resp "user-management-service/internal/lib/response"
+	"user-management-service/internal/models"
+	service "user-management-service/internal/service/oauth"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+type Service interface {
+	CreateClient(ctx context.Context, reg service.ClientRegistration) (*models.OAuthClient, string, error)
+	Clients(ctx context.Context) ([]models.OAuthClient, error)
+	DeleteClient(ctx context.Context, id string) error
+	Authorize(ctx context.Context, uuid string, req service.AuthorizeRequest) (*service.Authorization, error)
+	Consent(ctx context.Context, uuid string, req service.AuthorizeRequest, approved bool) (*service.Authorization, error)
+	Token(ctx context.Context, req service.TokenRequest, from models.Client) (*service.Token, error)
+	UserInfo(ctx context.Context, uuid string, grant jwt.Grant) (map[string]interface{}, error)
+	Introspect(ctx context.Context, req service.TokenCheckRequest) (*service.Introspection, error)
+	Revoke(ctx context.Context, req service.TokenCheckRequest) error
+}
+
+// errs are the errors of the service clients are told about, except for the
+// OAuth endpoints themselves, which answer with RFC 6749 errors
+var errs = resp.ErrorMap{
+	{Err: service.ErrClientNotFound, Status: http.StatusNotFound, Code: resp.CodeClientNotFound},
+	{Err: service.ErrInvalidClient, Status: http.StatusBadRequest, Code: resp.CodeInvalidRequest},
+	{Err: service.ErrInvalidRedirectURI, Status: http.StatusBadRequest, Code: resp.CodeInvalidRequest},
+	{Err: service.ErrInvalidClientName, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "name"},
+	{Err: service.ErrInvalidGrantTypes, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "grantTypes"},
+	{Err: service.ErrInvalidRedirectURIs, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "redirectUris"},
+	{Err: service.ErrInvalidScope, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "scopes"},
+}
+
+type Handler struct {
+	log     *slog.Logger
+	service Service
+}
+
+func New(log *slog.Logger, service Service) *Handler {
+	return &Handler{
+		log:     log,
+		service: service,
+	}
+}
+
+// Register registers the routes clients call on their own
+func (h *Handler) Register() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Post("/token", h.token)
+		r.Post("/introspect", h.introspect)
+		r.Post("/revoke", h.revoke)
+	}
+}
+
+// RegisterAuthorize registers the authorization endpoint, called on behalf of a logged-in user
+func (h *Handler) RegisterAuthorize() func(r chi.Router) {
+	return func(r chi.Router) {
+		// Scoped personal access tokens must not turn into OAuth grants of the whole account
+		r.Use(auth.RejectPersonalTokens())
+
+		r.Get("/", h.authorize)
+		r.Post("/", h.consent)
+	}
+}
+
+// UserInfo serves the claims about the user the bearer access token covers
+func (h *Handler) UserInfo() http.HandlerFunc {
+	return h.userInfo
+}
+
+// RegisterClients registers the routes of client registration
+func (h *Handler) RegisterClients() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Use(auth.RequirePermission(rbac.OAuthClientsManage))
+
+		r.Get("/", h.listClients)
+		r.Post("/", h.createClient)
+		r.Delete("/{id}", h.deleteClient)
+	}
+}
+
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.oauth.authorize"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to authorize: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	authorization, err := h.service.Authorize(r.Context(), principal.UUID, authorizeRequest(r.URL.Query()))
+	h.renderAuthorization(w, r, log, authorization, err)
+}
+
+func (h *Handler) consent(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.oauth.consent"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to consent: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	var req request.Consent
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	authorization, err := h.service.Consent(r.Context(), principal.UUID, authorizeRequest(r.URL.Query()), req.Approve)
+	h.renderAuthorization(w, r, log, authorization, err)
+}
+
+// renderAuthorization renders where to send the user next. Errors about an unknown
+// client or redirect uri can only be shown to the user, not sent to the client.
+func (h *Handler) renderAuthorization(w http.ResponseWriter, r *http.Request, log *slog.Logger, authorization *service.Authorization, err error) {
+	if err != nil {
+		var redirectErr *service.RedirectError
+		if errors.As(err, &redirectErr) {
+			log.Debug("authorization request rejected", sl.Error(err))
+			render.JSON(w, r, resp.Authorization{RedirectURI: redirectErr.RedirectURI})
+			return
+		}
+
+		log.Error("failed to authorize", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Authorization{
+		RedirectURI:     authorization.RedirectURI,
+		ConsentRequired: authorization.ConsentRequired,
+		Client:          authorization.Client,
+		Scopes:          authorization.Scopes,
+	})
+}
+
+func (h *Handler) token(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.oauth.token"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	// Tokens must not be cached anywhere on the way (RFC 6749 5.1)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	err := r.ParseForm()
+	if err != nil {
+		log.Debug("failed to parse token request", sl.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, resp.OAuthError{Error: "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, basic := clientCredentials(r)
+
+	token, err := h.service.Token(r.Context(), service.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		Scope:        r.PostForm.Get("scope"),
+
+		ClientAssertionType: r.PostForm.Get("client_assertion_type"),
+		ClientAssertion:     r.PostForm.Get("client_assertion"),
+	}, request.Client(r))
+	if err != nil {
+		renderError(w, r, log, "failed to issue token", err, basic)
+		return
+	}
+
+	render.JSON(w, r, resp.OAuthToken{
+		AccessToken:  token.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(token.ExpiresIn.Seconds()),
+		RefreshToken: token.RefreshToken,
+		IDToken:      token.IDToken,
+		Scope:        strings.Join(token.Scope, " "),
+	})
+}
+
+func (h *Handler) introspect(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.oauth.introspect"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	// Whether a token is active changes, the answer must not be reused
+	w.Header().Set("Cache-Control", "no-store")
+
+	req, basic, err := tokenCheckRequest(r)
+	if err != nil {
+		log.Debug("failed to parse introspection request", sl.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, resp.OAuthError{Error: "invalid_request"})
+		return
+	}
+
+	introspection, err := h.service.Introspect(r.Context(), req)
+	if err != nil {
+		renderError(w, r, log, "failed to introspect token", err, basic)
+		return
+	}
+
+	res := resp.OAuthIntrospection{Active: introspection.Active}
+	if introspection.Active {
+		res.TokenType = introspection.TokenType
+		res.PrincipalType = introspection.PrincipalType
+		res.Sub = introspection.Subject
+		res.ClientID = introspection.ClientID
+		res.Role = introspection.Role
+		res.Scope = strings.Join(introspection.Scope, " ")
+		if !introspection.ExpiresAt.IsZero() {
+			res.Exp = introspection.ExpiresAt.Unix()
+		}
+		if !introspection.IssuedAt.IsZero() {
+			res.Iat = introspection.IssuedAt.Unix()
+		}
+	}
+
+	render.JSON(w, r, res)
+}
+
+func (h *Handler) revoke(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.oauth.revoke"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	req, basic, err := tokenCheckRequest(r)
+	if err != nil {
+		log.Debug("failed to parse revocation request", sl.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, resp.OAuthError{Error: "invalid_request"})
+		return
+	}
+
+	err = h.service.Revoke(r.Context(), req)
+	if err != nil {
+		renderError(w, r, log, "failed to revoke token", err, basic)
+		return
+	}
+
+	// Whether the token was valid or not, the client only learns that it can't be used anymore
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) userInfo(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.oauth.userInfo"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to get user info: no principal in request context")
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, resp.OAuthError{Error: "server_error"})
+		return
+	}
+
+	claims, err := h.service.UserInfo(r.Context(), principal.UUID, principal.Grant)
+	if err != nil {
+		// Errors of a bearer token are told in WWW-Authenticate (RFC 6750 3)
+		switch {
+		case errors.Is(err, service.ErrInsufficientScope):
+			log.Debug("user info request rejected", sl.Error(err))
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			render.Status(r, http.StatusForbidden)
+			render.JSON(w, r, resp.OAuthError{Error: "insufficient_scope"})
+		case errors.Is(err, service.ErrUserNotFound):
+			log.Debug("user info request rejected", sl.Error(err))
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, resp.OAuthError{Error: "invalid_token"})
+		default:
+			log.Error("failed to get user info", sl.Error(err))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, resp.OAuthError{Error: "server_error"})
+		}
+		return
+	}
+
+	render.JSON(w, r, claims)
+}
+
+func (h *Handler) listClients(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.oauth.listClients"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	clients, err := h.service.Clients(r.Context())
+	if err != nil {
+		log.Error("failed to list oauth clients", sl.Error(err))
+		resp.Unexpected(w, r, err)
+		return
+	}
+
+	if clients == nil {
+		clients = []models.OAuthClient{}
+	}
+
+	render.JSON(w, r, resp.OAuthClients{Clients: clients})
+}
+
+func (h *Handler) createClient(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.oauth.createClient"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	var req request.CreateOAuthClient
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	client, clientSecret, err := h.service.CreateClient(r.Context(), service.ClientRegistration{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   req.GrantTypes,
+		Scopes:       req.Scopes,
+		Public:       req.Public,
+	})
+	if err != nil {
+		log.Error("failed to create oauth client", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.OAuthClientCreated{
+		Client:       client,
+		ClientSecret: clientSecret,
+	})
+}
+
+func (h *Handler) deleteClient(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.oauth.deleteClient"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	err := h.service.DeleteClient(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error("failed to delete oauth client", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
+
+// renderError renders an RFC 6749 5.2 error response. Client authentication
+// failures are 401, with a Basic challenge if the client tried Basic.
+func renderError(w http.ResponseWriter, r *http.Request, log *slog.Logger, msg string, err error, basic bool) {
+	code := service.ErrorCode(err)
+	switch code {
+	case "server_error":
+		log.Error(msg, sl.Error(err))
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, resp.OAuthError{Error: code})
+		return
+	case "invalid_client":
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		render.Status(r, http.StatusUnauthorized)
+	default:
+		render.Status(r, http.StatusBadRequest)
+	}
+	log.Debug("request rejected", sl.Error(err))
+	render.JSON(w, r, resp.OAuthError{Error: code, ErrorDescription: service.ErrorDescription(err)})
+}
+
+// clientCredentials returns the client credentials of a form-encoded request. They come
+// either in the Authorization header (RFC 6749 2.3.1) or in the body, basic tells which.
+func clientCredentials(r *http.Request) (string, string, bool) {
+	clientID, clientSecret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+		return clientID, clientSecret, true
+	}
+
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), false
+}
+
+// tokenCheckRequest reads a form-encoded introspection or revocation request
+func tokenCheckRequest(r *http.Request) (service.TokenCheckRequest, bool, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return service.TokenCheckRequest{}, false, err
+	}
+
+	clientID, clientSecret, basic := clientCredentials(r)
+
+	return service.TokenCheckRequest{
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		Token:         r.PostForm.Get("token"),
+		TokenTypeHint: r.PostForm.Get("token_type_hint"),
+	}, basic, nil
+}
+
+// authorizeRequest reads the parameters of an authorization request from the query string
+func authorizeRequest(q url.Values) service.AuthorizeRequest {
+	return service.AuthorizeRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+		Nonce:               q.Get("nonce"),
+	}
+}
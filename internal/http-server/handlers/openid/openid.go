@@ -0,0 +1,67 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/models"
+
+	"github.com/go-chi/render"
+)
+
+// Configuration is the OpenID Provider metadata (OpenID Connect Discovery 1.0, section 3)
+type Configuration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValues []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Register serves the metadata relying parties discover the service with.
+// issuer is the URL the service is reachable at, alg the one tokens are signed with.
+func Register(issuer, alg string, scopes []string, maxAge time.Duration) http.HandlerFunc {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	cfg := Configuration{
+		Issuer:                 issuer,
+		AuthorizationEndpoint:  issuer + "/oauth/authorize",
+		TokenEndpoint:          issuer + "/oauth/token",
+		UserInfoEndpoint:       issuer + "/userinfo",
+		JWKSURI:                issuer + "/.well-known/jwks.json",
+		ScopesSupported:        scopes,
+		ResponseTypesSupported: []string{"code"},
+		GrantTypesSupported: []string{
+			models.GrantAuthorizationCode,
+			models.GrantRefreshToken,
+			models.GrantClientCredentials,
+		},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{alg},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"},
+		TokenEndpointAuthSigningAlgValues: []string{jwt.AlgRS256, jwt.AlgES256, jwt.AlgEdDSA},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "nonce",
+			"name", "given_name", "family_name", "preferred_username", "updated_at",
+			"email", "email_verified", "phone_number", "groups",
+		},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+		render.JSON(w, r, cfg)
+	}
+}
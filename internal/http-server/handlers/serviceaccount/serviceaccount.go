@@ -0,0 +1,171 @@
+package serviceaccount
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"user-management-service/internal/http-server/middleware/auth"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/rbac"
+	"user-management-service/internal/lib/request"
+	resp "user-management-service/internal/lib/response"
+	"user-management-service/internal/models"
+	service "user-management-service/internal/service/serviceaccount"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+type Service interface {
+	Create(ctx context.Context, reg service.Registration, createdBy string) (*models.ServiceAccount, string, error)
+	ServiceAccount(ctx context.Context, id string) (*models.ServiceAccount, error)
+	List(ctx context.Context) ([]models.ServiceAccount, error)
+	RotateSecret(ctx context.Context, id string) (string, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// errs are the errors of the service clients are told about
+var errs = resp.ErrorMap{
+	{Err: service.ErrServiceAccountNotFound, Status: http.StatusNotFound, Code: resp.CodeServiceAccountNotFound},
+	{Err: service.ErrServiceAccountExists, Status: http.StatusConflict, Code: resp.CodeServiceAccountExists},
+	{Err: service.ErrInvalidName, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "name"},
+	{Err: service.ErrInvalidRole, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "role"},
+	{Err: service.ErrInvalidPublicKey, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "publicKey"},
+	{Err: service.ErrGroupNotFound, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "ownerGroupId"},
+}
+
+type Handler struct {
+	log     *slog.Logger
+	service Service
+}
+
+func New(log *slog.Logger, service Service) *Handler {
+	return &Handler{
+		log:     log,
+		service: service,
+	}
+}
+
+// Register registers the admin routes of service accounts
+func (h *Handler) Register() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Use(auth.RequirePermission(rbac.ServiceAccountsManage))
+
+		r.Get("/", h.list)
+		r.Post("/", h.create)
+		r.Get("/{id}", h.get)
+		r.Delete("/{id}", h.delete)
+		r.Post("/{id}/secret", h.rotateSecret)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.serviceaccount.list"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	accounts, err := h.service.List(r.Context())
+	if err != nil {
+		log.Error("failed to list service accounts", sl.Error(err))
+		resp.Internal(w, r)
+		return
+	}
+
+	if accounts == nil {
+		accounts = []models.ServiceAccount{}
+	}
+
+	render.JSON(w, r, resp.ServiceAccounts{ServiceAccounts: accounts})
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.serviceaccount.create"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to create service account: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	var req request.CreateServiceAccount
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	// Only users are recorded as creators, a service account may be creating another one
+	var createdBy string
+	if principal.Type == models.PrincipalUser {
+		createdBy = principal.UUID
+	}
+
+	account, accountSecret, err := h.service.Create(r.Context(), service.Registration{
+		Name:         req.Name,
+		Description:  req.Description,
+		Role:         req.Role,
+		OwnerGroupID: req.OwnerGroupID,
+		PublicKey:    req.PublicKey,
+	}, createdBy)
+	if err != nil {
+		log.Error("failed to create service account", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.ServiceAccountCreated{
+		ServiceAccount: account,
+		ClientSecret:   accountSecret,
+	})
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.serviceaccount.get"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	account, err := h.service.ServiceAccount(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error("failed to get service account", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, account)
+}
+
+func (h *Handler) rotateSecret(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.serviceaccount.rotateSecret"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	accountSecret, err := h.service.RotateSecret(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error("failed to rotate service account secret", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.ServiceAccountCreated{ClientSecret: accountSecret})
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.serviceaccount.delete"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	err := h.service.Delete(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error("failed to delete service account", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
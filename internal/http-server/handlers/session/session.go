@@ -0,0 +1,108 @@
+package session
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"user-management-service/internal/http-server/middleware/auth"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/request"
+	resp "user-management-service/internal/lib/response"
+	"user-management-service/internal/models"
+	service "user-management-service/internal/service/auth"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+type Service interface {
+	Sessions(ctx context.Context, uuid, current string) ([]models.Session, error)
+	RevokeSession(ctx context.Context, uuid, id string) error
+}
+
+// errs are the errors of the service clients are told about
+var errs = resp.ErrorMap{
+	{Err: service.ErrSessionNotFound, Status: http.StatusNotFound, Code: resp.CodeSessionNotFound},
+}
+
+type Handler struct {
+	log     *slog.Logger
+	service Service
+}
+
+func New(log *slog.Logger, service Service) *Handler {
+	return &Handler{
+		log:     log,
+		service: service,
+	}
+}
+
+func (h *Handler) Register() func(r chi.Router) {
+	return func(r chi.Router) {
+		// Personal access tokens belong to no session and must not end the ones of the user
+		r.Use(auth.RejectPersonalTokens())
+
+		r.Get("/", h.list)
+		r.Delete("/{id}", h.revoke)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.session.list"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to list sessions: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	// The session the access token was issued for
+	current, _ := principal.Claims["sid"].(string)
+
+	sessions, err := h.service.Sessions(r.Context(), principal.UUID, current)
+	if err != nil {
+		log.Error("failed to list sessions", sl.Error(err))
+		resp.Unexpected(w, r, err)
+		return
+	}
+
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+
+	render.JSON(w, r, resp.Sessions{Sessions: sessions})
+}
+
+func (h *Handler) revoke(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.session.revoke"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to revoke session: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	// Ids which can't be one are not found, rather than failing the query
+	id, ok := request.UUIDParam(r, "id")
+	if !ok {
+		errs.Render(w, r, service.ErrSessionNotFound)
+		return
+	}
+
+	err := h.service.RevokeSession(r.Context(), principal.UUID, id)
+	if err != nil {
+		log.Error("failed to revoke session", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
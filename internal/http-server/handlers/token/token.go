@@ -0,0 +1,146 @@
+package token
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"user-management-service/internal/http-server/middleware/auth"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/request"
+	resp "user-management-service/internal/lib/response"
+	"user-management-service/internal/models"
+	service "user-management-service/internal/service/auth"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+type Service interface {
+	CreatePersonalToken(ctx context.Context, uuid, name string, scopes []string, expiresAt *time.Time) (*models.PersonalAccessToken, string, error)
+	PersonalTokens(ctx context.Context, uuid string) ([]models.PersonalAccessToken, error)
+	DeletePersonalToken(ctx context.Context, uuid, id string) error
+}
+
+// errs are the errors of the service clients are told about
+var errs = resp.ErrorMap{
+	{Err: service.ErrPersonalTokenNotFound, Status: http.StatusNotFound, Code: resp.CodePersonalTokenNotFound, Detail: "personal access token not found"},
+	{Err: service.ErrInvalidTokenName, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "name"},
+	{Err: service.ErrInvalidTokenScopes, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "scopes"},
+	{Err: service.ErrInvalidTokenExpiry, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed, Field: "expiresAt"},
+	{Err: service.ErrTooManyPersonalTokens, Status: http.StatusConflict, Code: resp.CodeConflict},
+}
+
+type Handler struct {
+	log     *slog.Logger
+	service Service
+}
+
+func New(log *slog.Logger, service Service) *Handler {
+	return &Handler{
+		log:     log,
+		service: service,
+	}
+}
+
+// Register registers the routes of the caller's personal access tokens,
+// which can only be managed after an interactive login
+func (h *Handler) Register() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Use(auth.RejectPersonalTokens())
+
+		r.Get("/", h.list)
+		r.Post("/", h.create)
+		r.Delete("/{id}", h.delete)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.token.list"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to list personal access tokens: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	tokens, err := h.service.PersonalTokens(r.Context(), principal.UUID)
+	if err != nil {
+		log.Error("failed to list personal access tokens", sl.Error(err))
+		resp.Unexpected(w, r, err)
+		return
+	}
+
+	if tokens == nil {
+		tokens = []models.PersonalAccessToken{}
+	}
+
+	render.JSON(w, r, resp.PersonalTokens{Tokens: tokens})
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.token.create"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to create personal access token: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	var req request.CreatePersonalToken
+	err := request.Decode(w, r, &req)
+	if err != nil {
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
+		return
+	}
+
+	token, value, err := h.service.CreatePersonalToken(r.Context(), principal.UUID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		log.Error("failed to create personal access token", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.PersonalTokenCreated{
+		Token: token,
+		Value: value,
+	})
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	const op = "handlers.token.delete"
+
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to delete personal access token: no principal in request context")
+		resp.Internal(w, r)
+		return
+	}
+
+	// Ids which can't be one are not found, rather than failing the query
+	id, ok := request.UUIDParam(r, "id")
+	if !ok {
+		errs.Render(w, r, service.ErrPersonalTokenNotFound)
+		return
+	}
+
+	err := h.service.DeletePersonalToken(r.Context(), principal.UUID, id)
+	if err != nil {
+		log.Error("failed to delete personal access token", sl.Error(err))
+		errs.Render(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, resp.Ok())
+}
@@ -1,12 +1,14 @@
 package user
 
 import (
-	"errors"
+	"context"
 	"log/slog"
 	"net/http"
-	"user-management-service/internal/config"
-	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/http-server/middleware/auth"
+	"user-management-service/internal/lib/logger"
 	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/rbac"
+	"user-management-service/internal/lib/request"
 	resp "user-management-service/internal/lib/response"
 	"user-management-service/internal/models"
 	service "user-management-service/internal/service/user"
@@ -16,140 +18,141 @@ import (
 )
 
 type Service interface {
-	UserByUUID(uuid string) (*models.User, error)
-	PatchUser(uuid string, user *models.User) (*models.User, error)
-	Delete(uuid string) error
+	ActiveUser(ctx context.Context, uuid string) (*models.User, error)
+	PatchUser(ctx context.Context, uuid string, user *models.User) (*models.User, error)
+	Delete(ctx context.Context, uuid string) error
+}
+
+// errs are the errors of the service clients are told about
+var errs = resp.ErrorMap{
+	{Err: service.ErrUserNotFound, Status: http.StatusNotFound, Code: resp.CodeUserNotFound},
+	{Err: service.ErrUserBlocked, Status: http.StatusForbidden, Code: resp.CodeUserBlocked},
+	{Err: service.ErrUserExists, Status: http.StatusConflict, Code: resp.CodeUsernameTaken, Detail: "username is taken"},
+	{Err: service.ErrNoFieldsToUpdate, Status: http.StatusUnprocessableEntity, Code: resp.CodeValidationFailed},
 }
 
 type Handler struct {
-	log      *slog.Logger
-	service  Service
-	tokenCfg config.Token
+	log     *slog.Logger
+	service Service
 }
 
-func New(log *slog.Logger, service Service, tokenCfg config.Token) *Handler {
+func New(log *slog.Logger, service Service) *Handler {
 	return &Handler{
-		log:      log,
-		service:  service,
-		tokenCfg: tokenCfg,
+		log:     log,
+		service: service,
 	}
 }
 
+type ctxKey struct{}
+
 func (h *Handler) Register() func(r chi.Router) {
 	return func(r chi.Router) {
-		r.Get("/me", h.get)
-		r.Patch("/me", h.patch)
-		r.Delete("/me", h.delete)
+		r.Use(h.active)
+
+		r.With(auth.RequirePermission(rbac.MeRead)).Get("/me", h.get)
+
+		// A leaked personal access token must not take the account over
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RejectPersonalTokens())
+
+			r.Patch("/me", h.patch)
+			r.Delete("/me", h.delete)
+		})
 	}
 }
 
-func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
-	const op = "handlers.user.get"
+// active lets through only callers who are not blocked, putting their details in the request context
+func (h *Handler) active(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.active"
 
-	log := h.log.With(slog.String("op", op))
+		log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
 
-	// Retrive user id
-	claims, err := jwt.ExtractClaimsFromHeader(r, h.tokenCfg.JWT.Secret)
-	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			log.Error("token is expired", sl.Error(err))
-			render.JSON(w, r, resp.Err("token is expired"))
+		// Retrive user id
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			log.Error("failed to get user: no principal in request context")
+			resp.Internal(w, r)
 			return
 		}
-		log.Error("failed to extract jwt claims from header", sl.Error(err))
-		render.JSON(w, r, resp.Err("internal error"))
-		return
-	}
-
-	uuid, err := jwt.GetClaim(claims, "sub")
-	if err != nil {
-		log.Error("failed to get user", sl.Error(err))
-		render.JSON(w, r, resp.Err("internal error"))
-		return
-	}
+		uuid := principal.UUID
 
-	log.Debug("", slog.String("uuid", uuid))
+		log.Debug("", slog.String("uuid", uuid))
 
-	user, err := h.service.UserByUUID(uuid)
-	if err != nil {
-		log.Error("failed to get user", sl.Error(err))
-		if errors.As(err, &service.ErrUserNotFound) {
-			render.JSON(w, r, resp.Err("user not found"))
+		user, err := h.service.ActiveUser(r.Context(), uuid)
+		if err != nil {
+			log.Error("failed to get user", sl.Error(err))
+			errs.Render(w, r, err)
 			return
 		}
-		render.JSON(w, r, resp.Err("internal error"))
-		return
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, user)))
 	}
 
-	render.JSON(w, r, user)
+	return http.HandlerFunc(fn)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKey{}).(*models.User)
+
+	render.JSON(w, r, resp.NewSelfUser(user))
 }
 
 func (h *Handler) patch(w http.ResponseWriter, r *http.Request) {
 	const op = "handlers.user.patch"
 
-	log := h.log.With(slog.String("op", op))
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
 
 	// Retrive user id
-	claims, err := jwt.ExtractClaimsFromHeader(r, h.tokenCfg.JWT.Secret)
-	if err != nil {
-		log.Error("failed to extract jwt claims from header", sl.Error(err))
-		render.JSON(w, r, "internal error")
-		return
-	}
-
-	uuid, err := jwt.GetClaim(claims, "sub")
-	if err != nil {
-		log.Error("failed to patch user", sl.Error(err))
-		render.JSON(w, r, resp.Err("internal error"))
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to patch user: no principal in request context")
+		resp.Internal(w, r)
 		return
 	}
+	uuid := principal.UUID
 
-	var user models.User
-	err = render.DecodeJSON(r.Body, &user)
+	var req request.PatchUser
+	err := request.Decode(w, r, &req)
 	if err != nil {
-		log.Error("failed to patch user", sl.Error(err))
-		render.JSON(w, r, resp.Err("internal error"))
+		log.Debug("invalid request", sl.Error(err))
+		request.RenderError(w, r, err)
 		return
 	}
 
-	u, err := h.service.PatchUser(uuid, &user)
+	u, err := h.service.PatchUser(r.Context(), uuid, &models.User{
+		Name:        req.Name,
+		Surname:     req.Surname,
+		Username:    req.Username,
+		PhoneNumber: req.PhoneNumber,
+	})
 	if err != nil {
 		log.Error("failed to patch user", sl.Error(err))
-		if errors.As(err, &service.ErrNoFieldsToUpdate) {
-			render.JSON(w, r, resp.Err("no fields to update"))
-			return
-		}
-		render.JSON(w, r, resp.Err("internal error"))
+		errs.Render(w, r, err)
 		return
 	}
 
-	render.JSON(w, r, u)
+	render.JSON(w, r, resp.NewSelfUser(u))
 }
 
 func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
 	const op = "handlers.user.delete"
 
-	log := h.log.With(slog.String("op", op))
+	log := logger.FromContext(r.Context(), h.log).With(slog.String("op", op))
 
 	// Retrive user id
-	claims, err := jwt.ExtractClaimsFromHeader(r, h.tokenCfg.JWT.Secret)
-	if err != nil {
-		log.Error("failed to extract jwt claims from header", sl.Error(err))
-		render.JSON(w, r, "internal error")
-		return
-	}
-
-	uuid, err := jwt.GetClaim(claims, "sub")
-	if err != nil {
-		log.Error("failed to delete user", sl.Error(err))
-		render.JSON(w, r, resp.Err("internal error"))
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error("failed to delete user: no principal in request context")
+		resp.Internal(w, r)
 		return
 	}
+	uuid := principal.UUID
 
-	err = h.service.Delete(uuid)
+	err := h.service.Delete(r.Context(), uuid)
 	if err != nil {
 		log.Error("failed to delete user", sl.Error(err))
-		render.JSON(w, r, resp.Err("internal error"))
+		errs.Render(w, r, err)
 		return
 	}
 
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"user-management-service/internal/http-server/middleware/logging"
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/rbac"
+	resp "user-management-service/internal/lib/response"
+	"user-management-service/internal/models"
+	service "user-management-service/internal/service/auth"
+
+	"github.com/go-chi/jwtauth"
+)
+
+type ctxKey struct{}
+
+// Principal is the verified caller of a request
+type Principal struct {
+	// UUID identifies the principal among the ones of its Type,
+	// service accounts and OAuth clients have ids of their own
+	UUID   string
+	Type   string
+	Role   string
+	Claims map[string]interface{}
+	// PersonalToken is the id of the personal access token the caller
+	// authenticated with, whose Scopes limit what the role is granted
+	PersonalToken string
+	Scopes        []rbac.Permission
+	// Grant is the OAuth grant the access token was issued under, its
+	// ClientID is empty for the tokens of the service's own login
+	Grant jwt.Grant
+}
+
+// Can reports whether the principal's role is granted perm
+// and, for a personal access token, whether its scopes include it
+func (p *Principal) Can(perm rbac.Permission) bool {
+	if p.PersonalToken != "" && !slices.Contains(p.Scopes, perm) {
+		return false
+	}
+
+	return rbac.Can(p.Role, perm)
+}
+
+// PersonalTokens verifies personal access tokens
+type PersonalTokens interface {
+	VerifyPersonalToken(ctx context.Context, token string) (*models.PersonalAccessToken, string, error)
+}
+
+// New returns a middleware that verifies the bearer access token, checks that it
+// is not in the denylist and stores the caller in the request context. Personal
+// access tokens are accepted as well. Requests without a valid token are rejected.
+func New(log *slog.Logger, keys *jwt.KeySet, denylist Denylist, tokens PersonalTokens) func(next http.Handler) http.Handler {
+	log = log.With(slog.String("op", "middleware.auth"))
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			token := jwtauth.TokenFromHeader(r)
+			if strings.HasPrefix(token, models.PersonalAccessTokenPrefix) {
+				personal(w, r, next, log, tokens, token)
+				return
+			}
+
+			claims, err := jwt.Parse(token, keys, jwt.TypeAccess)
+			if err != nil {
+				log.Debug("failed to authenticate request", sl.Error(err))
+				if errors.Is(err, jwt.ErrTokenExpired) {
+					resp.Error(w, r, http.StatusUnauthorized, resp.CodeTokenExpired, "token is expired")
+					return
+				}
+				resp.Error(w, r, http.StatusUnauthorized, resp.CodeUnauthorized, "unauthorized")
+				return
+			}
+
+			uuid, err := jwt.GetClaim(claims, "sub")
+			if err != nil || uuid == "" {
+				log.Debug("token has no subject")
+				resp.Error(w, r, http.StatusUnauthorized, resp.CodeUnauthorized, "unauthorized")
+				return
+			}
+
+			revoked, err := jwt.Revoked(r.Context(), denylist, uuid, claims)
+			if err != nil {
+				log.Error("failed to check token revocation", sl.Error(err))
+				resp.Unexpected(w, r, err)
+				return
+			}
+			if revoked {
+				log.Debug("token is revoked", slog.String("uuid", uuid))
+				resp.Error(w, r, http.StatusUnauthorized, resp.CodeTokenRevoked, "token is revoked")
+				return
+			}
+
+			// Tokens issued for a role carry it, a missing one means no privileges
+			role, _ := claims["role"].(string)
+
+			p := &Principal{
+				UUID:   uuid,
+				Type:   jwt.PrincipalType(claims),
+				Role:   role,
+				Claims: claims,
+				Grant:  jwt.GrantFromClaims(claims),
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// personal authenticates the request with a personal access token
+func personal(w http.ResponseWriter, r *http.Request, next http.Handler, log *slog.Logger, tokens PersonalTokens, token string) {
+	pat, role, err := tokens.VerifyPersonalToken(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTokenExpired):
+			log.Debug("failed to authenticate request", sl.Error(err))
+			resp.Error(w, r, http.StatusUnauthorized, resp.CodeTokenExpired, "token is expired")
+		case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrUserBlocked):
+			log.Debug("failed to authenticate request", sl.Error(err))
+			resp.Error(w, r, http.StatusUnauthorized, resp.CodeUnauthorized, "unauthorized")
+		default:
+			log.Error("failed to verify personal access token", sl.Error(err))
+			resp.Unexpected(w, r, err)
+		}
+		return
+	}
+
+	scopes := make([]rbac.Permission, 0, len(pat.Scopes))
+	for _, scope := range pat.Scopes {
+		scopes = append(scopes, rbac.Permission(scope))
+	}
+
+	p := &Principal{
+		UUID:          pat.UserUUID,
+		Type:          models.PrincipalUser,
+		Role:          role,
+		Claims:        map[string]interface{}{"sub": pat.UserUUID},
+		PersonalToken: pat.ID,
+		Scopes:        scopes,
+	}
+
+	next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+}
+
+// RequireRole lets through only principals having one of roles
+func RequireRole(roles ...string) func(next http.Handler) http.Handler {
+	return require(func(p *Principal) bool {
+		return slices.Contains(roles, p.Role)
+	})
+}
+
+// RequirePermission lets through only principals granted all of perms
+func RequirePermission(perms ...rbac.Permission) func(next http.Handler) http.Handler {
+	return require(func(p *Principal) bool {
+		for _, perm := range perms {
+			if !p.Can(perm) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequirePrincipalType lets through only principals of one of types,
+// e.g. only users have an account of their own to manage
+func RequirePrincipalType(types ...string) func(next http.Handler) http.Handler {
+	return require(func(p *Principal) bool {
+		return slices.Contains(types, p.Type)
+	})
+}
+
+// RejectPersonalTokens keeps personal access tokens away from routes which manage
+// credentials, a leaked token must not be able to outlive its deletion
+func RejectPersonalTokens() func(next http.Handler) http.Handler {
+	return require(func(p *Principal) bool {
+		return p.PersonalToken == ""
+	})
+}
+
+// RejectDelegated keeps the access tokens of OAuth clients, whether issued on a user's
+// behalf or their own, away from the service's own API. Their scopes only cover /userinfo.
+func RejectDelegated() func(next http.Handler) http.Handler {
+	return require(func(p *Principal) bool {
+		return p.Grant.ClientID == ""
+	})
+}
+
+func require(allowed func(p *Principal) bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				resp.Error(w, r, http.StatusUnauthorized, resp.CodeUnauthorized, "unauthorized")
+				return
+			}
+
+			if !allowed(p) {
+				resp.Error(w, r, http.StatusForbidden, resp.CodeForbidden, "forbidden")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// WithPrincipal returns a copy of ctx carrying p, whose id is logged with the request from then on
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	ctx = logging.SetSubject(ctx, p.UUID)
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(*Principal)
+	return p, ok
+}
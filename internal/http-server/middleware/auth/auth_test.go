@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/rbac"
+	"user-management-service/internal/models"
+)
+
+func TestPrincipalCan(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		perm      rbac.Permission
+		want      bool
+	}{
+		{
+			name:      "access token of admin",
+			principal: Principal{Role: models.RoleAdmin},
+			perm:      rbac.UsersDelete,
+			want:      true,
+		},
+		{
+			name:      "personal token in scope",
+			principal: Principal{Role: models.RoleAdmin, PersonalToken: "id", Scopes: []rbac.Permission{rbac.UsersRead}},
+			perm:      rbac.UsersRead,
+			want:      true,
+		},
+		{
+			name:      "personal token out of scope",
+			principal: Principal{Role: models.RoleAdmin, PersonalToken: "id", Scopes: []rbac.Permission{rbac.UsersRead}},
+			perm:      rbac.UsersDelete,
+			want:      false,
+		},
+		{
+			name:      "personal token without scopes",
+			principal: Principal{Role: models.RoleAdmin, PersonalToken: "id"},
+			perm:      rbac.UsersRead,
+			want:      false,
+		},
+		{
+			name:      "personal token scope beyond role",
+			principal: Principal{Role: models.RoleModerator, PersonalToken: "id", Scopes: []rbac.Permission{rbac.UsersDelete}},
+			perm:      rbac.UsersDelete,
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.Can(tt.perm); got != tt.want {
+				t.Errorf("Can() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectDelegated(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		want      int
+	}{
+		{
+			name:      "token of own login",
+			principal: Principal{Type: models.PrincipalUser, Role: models.RoleAdmin},
+			want:      http.StatusOK,
+		},
+		{
+			name:      "token of a client on user's behalf",
+			principal: Principal{Type: models.PrincipalUser, Role: models.RoleAdmin, Grant: jwt.Grant{ClientID: "app", Scope: []string{jwt.ScopeRoles}}},
+			want:      http.StatusForbidden,
+		},
+		{
+			name:      "token of a client on its own behalf",
+			principal: Principal{Type: models.PrincipalClient, Grant: jwt.Grant{ClientID: "app"}},
+			want:      http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RejectDelegated()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+			r = r.WithContext(WithPrincipal(r.Context(), &tt.principal))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"user-management-service/internal/cache/local"
+	"user-management-service/internal/lib/jwt"
+)
+
+// Denylist knows which access tokens were revoked before they expired
+type Denylist = jwt.Denylist
+
+// CachedDenylist remembers the answers of a denylist for a while,
+// so that it is not asked on every request
+type CachedDenylist struct {
+	denylist Denylist
+	tokens   *local.Cache[bool]
+	sessions *local.Cache[bool]
+	users    *local.Cache[time.Time]
+}
+
+// NewCachedDenylist caches up to size answers of each kind for ttl
+func NewCachedDenylist(denylist Denylist, ttl time.Duration, size int) *CachedDenylist {
+	return &CachedDenylist{
+		denylist: denylist,
+		tokens:   local.New[bool](ttl, size),
+		sessions: local.New[bool](ttl, size),
+		users:    local.New[time.Time](ttl, size),
+	}
+}
+
+func (d *CachedDenylist) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	return cached(d.tokens, id, func() (bool, error) {
+		return d.denylist.IsTokenRevoked(ctx, id)
+	})
+}
+
+func (d *CachedDenylist) IsSessionRevoked(ctx context.Context, sid string) (bool, error) {
+	return cached(d.sessions, sid, func() (bool, error) {
+		return d.denylist.IsSessionRevoked(ctx, sid)
+	})
+}
+
+func (d *CachedDenylist) UserTokensRevokedAt(ctx context.Context, uuid string) (time.Time, error) {
+	return cached(d.users, uuid, func() (time.Time, error) {
+		return d.denylist.UserTokensRevokedAt(ctx, uuid)
+	})
+}
+
+func cached[V any](c *local.Cache[V], key string, load func() (V, error)) (V, error) {
+	if v, ok := c.Get(key); ok {
+		return v, nil
+	}
+
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	c.Set(key, v)
+
+	return v, nil
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/request"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+type entryKey struct{}
+
+// entry is what handlers down the chain tell the access log about the request
+type entry struct {
+	sub string
+}
+
+// AccessLog logs every request once it is served, with its status, size and
+// latency. It also puts the logger of the request in its context, tagging every
+// line logged while serving it with the request id, see logger.FromContext.
+func AccessLog(log *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			reqLog := log.With(slog.String("request_id", GetRequestID(r.Context())))
+			e := &entry{}
+			ctx := logger.WithContext(context.WithValue(r.Context(), entryKey{}, e), reqLog)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			client := request.Client(r)
+			reqLog.LogAttrs(ctx, level, "request served",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("proto", r.Proto),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("ip", client.IP),
+				slog.String("user_agent", client.UserAgent),
+				slog.String("sub", e.sub),
+			)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// SetSubject records who the request is served to, for the access log and
+// every line logged from here on. The auth middleware calls it.
+func SetSubject(ctx context.Context, sub string) context.Context {
+	if e, ok := ctx.Value(entryKey{}).(*entry); ok {
+		e.sub = sub
+	}
+
+	if log := logger.FromContext(ctx, nil); log != nil {
+		ctx = logger.WithContext(ctx, log.With(slog.String("sub", sub)))
+	}
+
+	return ctx
+}
@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"user-management-service/internal/lib/logger"
+	resp "user-management-service/internal/lib/response"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:51234", want: "203.0.113.7:51234"},
+		{name: "untrusted peer can't forward", remoteAddr: "203.0.113.7:51234", forwarded: "198.51.100.1", want: "203.0.113.7:51234"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:443", forwarded: "198.51.100.1", want: "198.51.100.1"},
+		{name: "forged hops are skipped", remoteAddr: "10.0.0.2:443", forwarded: "1.2.3.4, 198.51.100.1, 10.0.0.3", want: "198.51.100.1"},
+		{name: "only proxies", remoteAddr: "10.0.0.2:443", forwarded: "10.0.0.4, 10.0.0.3", want: "10.0.0.4"},
+		{name: "garbage hop", remoteAddr: "10.0.0.2:443", forwarded: "198.51.100.1, garbage", want: "10.0.0.2"},
+		{name: "x-real-ip", remoteAddr: "10.0.0.2:443", realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "ipv6", remoteAddr: "10.0.0.2:443", forwarded: "2001:db8::1", want: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			var got string
+			RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{name: "propagated", incoming: "abc-123", wantSame: true},
+		{name: "generated", incoming: ""},
+		{name: "log injection", incoming: "abc\" level=ERROR msg=\"forged"},
+		{name: "too long", incoming: strings.Repeat("a", 65)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+			r.Header.Set(resp.HeaderRequestID, tt.incoming)
+			w := httptest.NewRecorder()
+
+			var got string
+			RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = GetRequestID(r.Context())
+			})).ServeHTTP(w, r)
+
+			if got == "" || w.Header().Get(resp.HeaderRequestID) != got {
+				t.Fatalf("request id = %q, header = %q", got, w.Header().Get(resp.HeaderRequestID))
+			}
+			if (got == tt.incoming) != tt.wantSame {
+				t.Errorf("request id = %q, incoming %q", got, tt.incoming)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	h := RequestID(AccessLog(log)(Recover(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(SetSubject(r.Context(), "5f0c1b8e"))
+		logger.FromContext(r.Context(), nil).Info("serving")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "hello")
+	}))))
+
+	r := httptest.NewRequest(http.MethodPost, "/auth/signup", nil)
+	r.Header.Set(resp.HeaderRequestID, "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2: %s", len(lines), buf.String())
+	}
+
+	var handlerLine, access map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &handlerLine); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &access); err != nil {
+		t.Fatal(err)
+	}
+
+	if handlerLine["request_id"] != "req-1" || handlerLine["sub"] != "5f0c1b8e" {
+		t.Errorf("handler line = %v, want it tagged with the request id and sub", handlerLine)
+	}
+	want := map[string]any{"request_id": "req-1", "method": "POST", "path": "/auth/signup", "status": float64(201), "bytes": float64(5), "sub": "5f0c1b8e"}
+	for k, v := range want {
+		if access[k] != v {
+			t.Errorf("access log %s = %v, want %v", k, access[k], v)
+		}
+	}
+	if _, ok := access["latency_ms"]; !ok {
+		t.Error("access log has no latency")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	h := RequestID(AccessLog(log)(Recover(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]string
+		m["boom"] = "nil map"
+	}))))
+
+	r := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+	r.Header.Set(resp.HeaderRequestID, "req-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	var p resp.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("failed to decode problem: %v", err)
+	}
+	if p.Code != resp.CodeInternal || p.RequestID != "req-1" {
+		t.Errorf("problem = %+v, want an internal error of request req-1", p)
+	}
+	if !strings.Contains(buf.String(), "assignment to entry in nil map") || !strings.Contains(buf.String(), `"status":500`) {
+		t.Errorf("log = %s, want the panic and a 500 access log", buf.String())
+	}
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// RealIP replaces the RemoteAddr of requests coming through one of the trusted
+// proxies with the address of the client they were forwarded for. The
+// X-Forwarded-For chain is walked from the right, the first address that isn't
+// a trusted proxy is the client, since anything left of it may be forged.
+// X-Real-IP is used when a trusted proxy doesn't send X-Forwarded-For.
+// Requests from anywhere else keep their RemoteAddr.
+func RealIP(trusted []netip.Prefix) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := clientIP(r, trusted); ok {
+				r.RemoteAddr = ip.String()
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func clientIP(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	peer, ok := parseIP(r.RemoteAddr)
+	if !ok || !isTrusted(peer, trusted) {
+		return netip.Addr{}, false
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	if len(hops) == 0 {
+		return parseIP(r.Header.Get("X-Real-IP"))
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := parseIP(hops[i])
+		if !ok {
+			break
+		}
+		client = ip
+		if !isTrusted(ip, trusted) {
+			break
+		}
+	}
+
+	return client, true
+}
+
+func isTrusted(ip netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseIP parses an address with or without a port
+func parseIP(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return ip.Unmap(), true
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"user-management-service/internal/lib/logger"
+	resp "user-management-service/internal/lib/response"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// Recover turns a panic while serving a request into an internal error problem,
+// logging the panic and its stack, instead of dropping the connection. Nothing is
+// rendered if the response was already under way.
+func Recover(log *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// Aborting the response on purpose is what net/http expects to see
+				if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(rec)
+				}
+
+				logger.FromContext(r.Context(), log).Error("panic while serving request",
+					slog.Any("panic", rec),
+					slog.String("stack", string(debug.Stack())),
+				)
+
+				if ww.Status() == 0 {
+					resp.Internal(ww, r)
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	resp "user-management-service/internal/lib/response"
+)
+
+type requestIDKey struct{}
+
+// validRequestID is what is taken from the X-Request-ID of the client or proxy,
+// anything else would let them inject into logs
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,64}$`)
+
+// RequestID identifies every request by the X-Request-ID header it comes with, or
+// a new one. The id is sent back in the X-Request-ID of the response.
+func RequestID(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(resp.HeaderRequestID)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(resp.HeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// GetRequestID returns the id of the request ctx belongs to
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand doesn't fail on the platforms we run on
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
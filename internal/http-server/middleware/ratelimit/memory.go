@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"user-management-service/internal/cache/local"
+)
+
+// Memory is a Store keeping the counts in process, so each replica counts on its own
+type Memory struct {
+	// mu makes reading and advancing an arrival time one step
+	mu   sync.Mutex
+	tats *local.Cache[time.Time]
+}
+
+// NewMemory returns a store counting up to size keys
+func NewMemory(size int) *Memory {
+	return &Memory{
+		// Arrival times are kept until they pass, each for its own ttl
+		tats: local.New[time.Time](0, size),
+	}
+}
+
+func (m *Memory) GCRA(_ context.Context, key string, interval time.Duration, burst int) (bool, time.Duration, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A key which is gone has been allowed a full burst by now
+	tat, _ := m.tats.Get(key)
+
+	allowed, tat := gcra(now, tat, interval, burst)
+	if allowed {
+		m.tats.SetFor(key, tat, tat.Sub(now))
+	}
+
+	return allowed, tat.Sub(now), nil
+}
+
+// gcra lets a request through if the theoretical arrival time after it is no further
+// ahead of now than burst intervals. It returns the arrival time after the request,
+// which stays as it was when the request is rejected.
+func gcra(now, tat time.Time, interval time.Duration, burst int) (bool, time.Time) {
+	if tat.Before(now) {
+		tat = now
+	}
+
+	next := tat.Add(interval)
+	if next.Sub(now) > interval*time.Duration(burst) {
+		return false, tat
+	}
+
+	return true, next
+}
@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/http-server/middleware/auth"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/request"
+	resp "user-management-service/internal/lib/response"
+)
+
+// Store counts requests with the generic cell rate algorithm. GCRA reports whether
+// a request of key is allowed and how long until the key is allowed a full burst again.
+type Store interface {
+	GCRA(ctx context.Context, key string, interval time.Duration, burst int) (bool, time.Duration, error)
+}
+
+// KeyFunc tells whose budget the request is counted against
+type KeyFunc func(r *http.Request) string
+
+// Policy limits the requests of every key to Rate. Its Name keeps the
+// budgets of policies apart when they count the same keys.
+type Policy struct {
+	Name string
+	Rate config.Rate
+	Key  KeyFunc
+}
+
+// Limiter applies policies with the counts kept in store, or in memory while
+// the store is unavailable, so that an outage doesn't take the service down
+type Limiter struct {
+	log      *slog.Logger
+	store    Store
+	fallback *Memory
+	cfg      config.RateLimit
+}
+
+func New(log *slog.Logger, store Store, cfg config.RateLimit) *Limiter {
+	return &Limiter{
+		log:      log.With(slog.String("op", "middleware.ratelimit")),
+		store:    store,
+		fallback: NewMemory(cfg.FallbackSize),
+		cfg:      cfg,
+	}
+}
+
+// Limit returns a middleware rejecting the requests over the policy's rate with
+// 429 Too Many Requests. Every response carries the RateLimit-* headers.
+func (l *Limiter) Limit(p Policy) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !l.cfg.Enabled || p.Rate.Requests <= 0 {
+			return next
+		}
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if l.allow(w, r, p) {
+				next.ServeHTTP(w, r)
+			}
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Route is Limit for the requests of method to one of paths only
+func (l *Limiter) Route(p Policy, method string, paths ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limited := l.Limit(p)(next)
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == method && slices.Contains(paths, r.URL.Path) {
+				limited.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// allow counts the request and writes the headers, and the response if it is rejected
+func (l *Limiter) allow(w http.ResponseWriter, r *http.Request, p Policy) bool {
+	interval := p.Rate.Period / time.Duration(p.Rate.Requests)
+	burst := p.Rate.Requests
+	key := p.Name + ":" + p.Key(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), l.cfg.StoreTimeout)
+	defer cancel()
+
+	allowed, ahead, err := l.store.GCRA(ctx, key, interval, burst)
+	if err != nil {
+		l.log.Warn("failed to count request, counting in memory", slog.String("policy", p.Name), sl.Error(err))
+		allowed, ahead, _ = l.fallback.GCRA(r.Context(), key, interval, burst)
+	}
+
+	res := result(allowed, ahead, interval, burst)
+
+	h := w.Header()
+	h.Set("RateLimit-Policy", strconv.Itoa(burst)+";w="+strconv.Itoa(int(p.Rate.Period.Seconds())))
+	h.Set("RateLimit-Limit", strconv.Itoa(burst))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+	h.Set("RateLimit-Reset", seconds(res.reset))
+
+	if !allowed {
+		l.log.Debug("request rate limited", slog.String("policy", p.Name), slog.String("key", key))
+		h.Set("Retry-After", seconds(res.retryAfter))
+		resp.Error(w, r, http.StatusTooManyRequests, resp.CodeTooManyRequests, "too many requests")
+		return false
+	}
+
+	return true
+}
+
+type limitResult struct {
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// result tells what is left of the burst, given how far ahead of now
+// the theoretical arrival time of the key is after the request
+func result(allowed bool, ahead, interval time.Duration, burst int) limitResult {
+	tolerance := interval * time.Duration(burst)
+
+	res := limitResult{
+		remaining: max(int((tolerance-ahead)/interval), 0),
+		reset:     ahead,
+	}
+	if !allowed {
+		res.retryAfter = max(ahead+interval-tolerance, 0)
+	}
+
+	return res
+}
+
+// seconds rounds d up to whole seconds, not to invite a retry that is rejected again
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// ByIP counts requests per client address
+func ByIP(r *http.Request) string {
+	return "ip:" + request.Client(r).IP
+}
+
+// BySubject counts requests per authenticated principal, anonymous ones per client address
+func BySubject(r *http.Request) string {
+	p, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return ByIP(r)
+	}
+
+	return p.Type + ":" + p.UUID
+}
+
+// ByAPIKey counts requests per personal access token, others as BySubject does
+func ByAPIKey(r *http.Request) string {
+	p, ok := auth.PrincipalFromContext(r.Context())
+	if !ok || p.PersonalToken == "" {
+		return BySubject(r)
+	}
+
+	return "pat:" + p.PersonalToken
+}
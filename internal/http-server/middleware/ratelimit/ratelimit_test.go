@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"user-management-service/internal/config"
+)
+
+type failingStore struct{}
+
+func (failingStore) GCRA(context.Context, string, time.Duration, int) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		store         Store
+		rate          config.Rate
+		requests      int
+		wantStatus    int
+		wantRemaining string
+		wantRetry     bool
+	}{
+		{name: "within burst", store: NewMemory(10), rate: config.Rate{Requests: 3, Period: time.Minute}, requests: 3, wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "over burst", store: NewMemory(10), rate: config.Rate{Requests: 3, Period: time.Minute}, requests: 4, wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: true},
+		{name: "first request", store: NewMemory(10), rate: config.Rate{Requests: 3, Period: time.Minute}, requests: 1, wantStatus: http.StatusOK, wantRemaining: "2"},
+		{name: "store unavailable", store: failingStore{}, rate: config.Rate{Requests: 1, Period: time.Minute}, requests: 2, wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: true},
+		{name: "disabled", store: failingStore{}, rate: config.Rate{}, requests: 5, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			l := New(log, tt.store, config.RateLimit{Enabled: true, StoreTimeout: time.Second, FallbackSize: 10})
+
+			h := l.Limit(Policy{Name: "test", Rate: tt.rate, Key: ByIP})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				rec = httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/signup", nil))
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("RateLimit-Remaining = %q, want %q", got, tt.wantRemaining)
+			}
+			if got := rec.Header().Get("Retry-After") != ""; got != tt.wantRetry {
+				t.Errorf("Retry-After set = %v, want %v", got, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestGCRA(t *testing.T) {
+	now := time.Now()
+	interval := time.Second
+
+	tests := []struct {
+		name        string
+		tat         time.Time
+		wantAllowed bool
+		wantTAT     time.Time
+	}{
+		{name: "new key", tat: time.Time{}, wantAllowed: true, wantTAT: now.Add(interval)},
+		{name: "past arrival time", tat: now.Add(-time.Hour), wantAllowed: true, wantTAT: now.Add(interval)},
+		{name: "last of burst", tat: now.Add(2 * interval), wantAllowed: true, wantTAT: now.Add(3 * interval)},
+		{name: "burst used up", tat: now.Add(3 * interval), wantAllowed: false, wantTAT: now.Add(3 * interval)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, tat := gcra(now, tt.tat, interval, 3)
+			if allowed != tt.wantAllowed {
+				t.Errorf("gcra() allowed = %v, want %v", allowed, tt.wantAllowed)
+			}
+			if !tat.Equal(tt.wantTAT) {
+				t.Errorf("gcra() tat = %v, want %v", tat, tt.wantTAT)
+			}
+		})
+	}
+}
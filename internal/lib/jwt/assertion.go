@@ -0,0 +1,109 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidPublicKey = errors.New("invalid public key")
+
+// MaxAssertionTTL bounds the lifetime of a client assertion,
+// so that the ids of the used ones need not be kept for long
+const MaxAssertionTTL = 5 * time.Minute
+
+// minRSAKeyBits is the smallest RSA key accepted
+const minRSAKeyBits = 2048
+
+// ParsePublicKey parses a PEM encoded public key of one of the supported
+// algorithms and returns it along with the algorithm it signs with
+func ParsePublicKey(pemKey string) (crypto.PublicKey, string, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, "", ErrInvalidPublicKey
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() >= minRSAKeyBits {
+			return k, AlgRS256, nil
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return k, AlgES256, nil
+		}
+	case ed25519.PublicKey:
+		return k, AlgEdDSA, nil
+	}
+
+	return nil, "", ErrInvalidPublicKey
+}
+
+// ParseAssertion verifies a JWT a client authenticates with (RFC 7523 3): signed with
+// publicKey, issued by and about clientID, meant for one of audiences and valid for at
+// most MaxAssertionTTL. The caller must not accept the "jti" of the returned claims twice.
+func ParseAssertion(assertion, publicKey, clientID string, audiences []string) (jwt.MapClaims, error) {
+	const op = "ParseAssertion"
+
+	key, alg, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := jwt.Parse(assertion, func(*jwt.Token) (interface{}, error) {
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{alg}),
+		jwt.WithIssuer(clientID),
+		jwt.WithSubject(clientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	aud, err := claims.GetAudience()
+	if err != nil || !slices.ContainsFunc(aud, func(a string) bool { return slices.Contains(audiences, a) }) {
+		return nil, fmt.Errorf("%s: %w: audience mismatch", op, ErrInvalidToken)
+	}
+
+	if Remaining(claims) > MaxAssertionTTL {
+		return nil, fmt.Errorf("%s: %w: valid for too long", op, ErrInvalidToken)
+	}
+
+	if jti, ok := claims["jti"].(string); !ok || jti == "" {
+		return nil, fmt.Errorf("%s: %w: no jti", op, ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// AssertionIssuer returns the issuer of an assertion without verifying it,
+// to find the client whose key verifies it
+func AssertionIssuer(assertion string) string {
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(assertion, claims)
+	if err != nil {
+		return ""
+	}
+
+	iss, _ := claims.GetIssuer()
+	return iss
+}
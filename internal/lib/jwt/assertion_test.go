@@ -0,0 +1,85 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseAssertion(t *testing.T) {
+	const (
+		clientID = "sa_test"
+		audience = "http://localhost:8080/oauth/token"
+	)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	_, otherPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := func(modify func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss": clientID,
+			"sub": clientID,
+			"aud": audience,
+			"jti": "assertion-id",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		key     ed25519.PrivateKey
+		wantErr bool
+	}{
+		{name: "valid", claims: claims(nil), key: private},
+		{name: "other key", claims: claims(nil), key: otherPrivate, wantErr: true},
+		{name: "other issuer", claims: claims(func(c jwt.MapClaims) { c["iss"] = "sa_other" }), key: private, wantErr: true},
+		{name: "other audience", claims: claims(func(c jwt.MapClaims) { c["aud"] = "https://example.com" }), key: private, wantErr: true},
+		{name: "no expiry", claims: claims(func(c jwt.MapClaims) { delete(c, "exp") }), key: private, wantErr: true},
+		{
+			name:    "valid for too long",
+			claims:  claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(time.Hour).Unix() }),
+			key:     private,
+			wantErr: true,
+		},
+		{name: "no jti", claims: claims(func(c jwt.MapClaims) { delete(c, "jti") }), key: private, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertion, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, tt.claims).SignedString(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = ParseAssertion(assertion, publicPEM, clientID, []string{audience})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAssertion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ParseAssertion() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
@@ -1,13 +1,19 @@
 package jwt
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"user-management-service/internal/config"
+	"user-management-service/internal/lib/secret"
 	"user-management-service/internal/models"
 
 	"github.com/go-chi/jwtauth"
@@ -15,20 +21,82 @@ import (
 )
 
 var (
-	ErrTokenExpired = errors.New("token is expired")
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrInvalidTokenType = errors.New("invalid token type")
 )
 
-func NewAccessToken(user *models.User, cfg config.Token) (string, error) {
+// Token types, written into the "typ" claim so that a token issued for one
+// purpose can't be used for another
+const (
+	TypeAccess            = "access"
+	TypeRefresh           = "refresh"
+	TypeEmailVerification = "email_verification"
+	TypeMFAChallenge      = "mfa_challenge"
+	TypeID                = "id"
+)
+
+// jtiSize is the number of random bytes in the id of an access token
+const jtiSize = 16
+
+// ScopeRoles grants an OAuth client the user's role and groups
+const ScopeRoles = "roles"
+
+// Grant is what the user allowed an OAuth client to do on their behalf.
+// Tokens issued by the service's own login have a zero Grant.
+type Grant struct {
+	ClientID string
+	Scope    []string
+}
+
+// Has reports whether the grant includes scope
+func (g Grant) Has(scope string) bool {
+	return slices.Contains(g.Scope, scope)
+}
+
+// GrantFromClaims returns the grant a token was issued under
+func GrantFromClaims(claims jwt.MapClaims) Grant {
+	clientID, _ := claims["client_id"].(string)
+	scope, _ := claims["scope"].(string)
+
+	return Grant{
+		ClientID: clientID,
+		Scope:    strings.Fields(scope),
+	}
+}
+
+// NewAccessToken issues an access token of the user's session sessionID.
+// Under an OAuth grant the user's role and groups are only included with the roles scope.
+func NewAccessToken(user *models.User, sessionID string, grant Grant, cfg config.Token, keys *KeySet) (string, error) {
 	const op = "NewAccessToken"
 
-	token := jwt.New(jwt.SigningMethodHS256)
+	jti, err := secret.New(jtiSize)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
 
-	claims := token.Claims.(jwt.MapClaims)
+	claims := jwt.MapClaims{}
 	claims["sub"] = user.UUID
-	claims["role"] = user.Role
+	claims["jti"] = jti
+	claims["sid"] = sessionID
+	claims["typ"] = TypeAccess
+	claims["principal_type"] = models.PrincipalUser
+	claims["iat"] = numericDate(time.Now())
 	claims["exp"] = time.Now().Add(cfg.JWT.TTL).Unix()
+	setGrant(claims, grant)
+
+	if grant.ClientID == "" || grant.Has(ScopeRoles) {
+		claims["role"] = user.Role
+		if cfg.JWT.GroupsClaim {
+			groups := user.Groups
+			if groups == nil {
+				groups = []string{}
+			}
+			claims["groups"] = groups
+		}
+	}
 
-	tokenString, err := token.SignedString([]byte(cfg.JWT.Secret))
+	tokenString, err := keys.Sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -36,16 +104,151 @@ func NewAccessToken(user *models.User, cfg config.Token) (string, error) {
 	return tokenString, nil
 }
 
-func NewRefreshToken(user *models.User, cfg config.Token) (string, error) {
-	const op = "NewRefreshToken"
+// NewClientAccessToken issues an access token to the OAuth client itself, acting on no user's behalf
+func NewClientAccessToken(clientID string, scope []string, cfg config.Token, keys *KeySet) (string, error) {
+	const op = "NewClientAccessToken"
 
-	token := jwt.New(jwt.SigningMethodHS256)
+	jti, err := secret.New(jtiSize)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
 
-	claims := token.Claims.(jwt.MapClaims)
+	claims := jwt.MapClaims{}
+	claims["sub"] = clientID
+	claims["jti"] = jti
+	claims["typ"] = TypeAccess
+	claims["principal_type"] = models.PrincipalClient
+	claims["iat"] = numericDate(time.Now())
+	claims["exp"] = time.Now().Add(cfg.JWT.TTL).Unix()
+	setGrant(claims, Grant{ClientID: clientID, Scope: scope})
+
+	tokenString, err := keys.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokenString, nil
+}
+
+// NewServiceAccountToken issues an access token to the service account, carrying its role
+func NewServiceAccountToken(account *models.ServiceAccount, cfg config.Token, keys *KeySet) (string, error) {
+	const op = "NewServiceAccountToken"
+
+	jti, err := secret.New(jtiSize)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	claims := jwt.MapClaims{}
+	claims["sub"] = account.ID
+	claims["jti"] = jti
+	claims["typ"] = TypeAccess
+	claims["principal_type"] = models.PrincipalServiceAccount
+	claims["role"] = account.Role
+	claims["iat"] = numericDate(time.Now())
+	claims["exp"] = time.Now().Add(cfg.JWT.TTL).Unix()
+
+	tokenString, err := keys.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokenString, nil
+}
+
+// PrincipalType returns who the access token was issued to. Tokens
+// issued before the "principal_type" claim was introduced are the users'.
+func PrincipalType(claims jwt.MapClaims) string {
+	if t, ok := claims["principal_type"].(string); ok && t != "" {
+		return t
+	}
+
+	return models.PrincipalUser
+}
+
+// NewIDToken issues an OpenID Connect ID token telling the client clientID who the user
+// is. userClaims are the claims about the user the client was granted, including "sub".
+func NewIDToken(userClaims map[string]interface{}, clientID, nonce, issuer string, cfg config.Token, keys *KeySet) (string, error) {
+	const op = "NewIDToken"
+
+	claims := jwt.MapClaims{}
+	for k, v := range userClaims {
+		claims[k] = v
+	}
+	claims["iss"] = issuer
+	claims["aud"] = clientID
+	claims["azp"] = clientID
+	claims["typ"] = TypeID
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(cfg.JWT.TTL).Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	tokenString, err := keys.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokenString, nil
+}
+
+// NewRefreshToken issues the refresh token jti of the token family, which is the user's session
+func NewRefreshToken(user *models.User, familyID, jti string, grant Grant, cfg config.Token, keys *KeySet) (string, error) {
+	const op = "NewRefreshToken"
+
+	claims := jwt.MapClaims{}
 	claims["sub"] = user.UUID
+	claims["jti"] = jti
+	claims["family_id"] = familyID
+	claims["typ"] = TypeRefresh
+	claims["iat"] = numericDate(time.Now())
 	claims["exp"] = time.Now().Add(cfg.Refresh.TTL).Unix()
+	setGrant(claims, grant)
+
+	tokenString, err := keys.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokenString, nil
+}
+
+// NewEmailVerificationToken issues a token confirming that the user owns user.Email
+func NewEmailVerificationToken(user *models.User, cfg config.Token, keys *KeySet) (string, error) {
+	const op = "NewEmailVerificationToken"
+
+	claims := jwt.MapClaims{}
+	claims["sub"] = user.UUID
+	claims["typ"] = TypeEmailVerification
+	claims["email"] = user.Email
+	claims["exp"] = time.Now().Add(cfg.Verification.TTL).Unix()
+
+	tokenString, err := keys.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokenString, nil
+}
+
+// NewMFAChallengeToken issues a token proving that the user passed the first login
+// factor, to be exchanged once for a token pair together with the second one
+func NewMFAChallengeToken(user *models.User, cfg config.Token, keys *KeySet) (string, error) {
+	const op = "NewMFAChallengeToken"
+
+	jti, err := secret.New(jtiSize)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	claims := jwt.MapClaims{}
+	claims["sub"] = user.UUID
+	claims["jti"] = jti
+	claims["typ"] = TypeMFAChallenge
+	claims["exp"] = time.Now().Add(cfg.MFA.TTL).Unix()
 
-	tokenString, err := token.SignedString([]byte(cfg.JWT.Secret))
+	tokenString, err := keys.Sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -53,6 +256,103 @@ func NewRefreshToken(user *models.User, cfg config.Token) (string, error) {
 	return tokenString, nil
 }
 
+// setGrant writes the grant into the "client_id" and "scope" claims
+func setGrant(claims jwt.MapClaims, grant Grant) {
+	if grant.ClientID == "" {
+		return
+	}
+
+	claims["client_id"] = grant.ClientID
+	claims["scope"] = strings.Join(grant.Scope, " ")
+}
+
+// Parse verifies the token signature and expiry and checks that it was issued as typ.
+// Tokens without a "typ" claim were signed with keys which are gone, they are invalid.
+func Parse(tokenString string, keys *KeySet, typ string) (jwt.MapClaims, error) {
+	const op = "Parse"
+
+	token, err := jwt.Parse(tokenString, keys.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()))
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, fmt.Errorf("%s: %w", op, ErrTokenExpired)
+		}
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	if t, _ := claims["typ"].(string); t != typ {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidTokenType)
+	}
+
+	return claims, nil
+}
+
+// ID identifies the token by its "jti" claim, or by its hash if it was issued without one
+func ID(claims jwt.MapClaims, tokenString string) string {
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		return jti
+	}
+
+	return LegacyID(tokenString)
+}
+
+// LegacyID identifies a token issued without a "jti" claim
+func LegacyID(tokenString string) string {
+	return "sha256:" + hex.EncodeToString(secret.Hash(tokenString))
+}
+
+// numericDate is the time t in seconds with a millisecond precision, as in the
+// "iat" claim of tokens which may be revoked along with the rest of their user's.
+// A token issued right after a revocation mark must not be taken for one issued
+// before it, which whole seconds can't tell apart.
+func numericDate(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+// IssuedBefore reports whether the token may have been issued before t. Tokens without
+// an "iat" claim are older than any t. Issue times and revocation marks have a precision
+// of a millisecond, so the tokens issued during the millisecond of t count as issued
+// before it, as do the ones with a whole second "iat" issued by older releases.
+func IssuedBefore(claims jwt.MapClaims, t time.Time) bool {
+	iat, ok := issuedAt(claims)
+	if !ok {
+		return true
+	}
+
+	return !iat.After(t)
+}
+
+// issuedAt reads the "iat" claim to the millisecond, jwt.MapClaims.GetIssuedAt
+// truncates it to the second
+func issuedAt(claims jwt.MapClaims) (time.Time, bool) {
+	var sec float64
+	switch iat := claims["iat"].(type) {
+	case float64:
+		sec = iat
+	case json.Number:
+		f, err := iat.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		sec = f
+	default:
+		return time.Time{}, false
+	}
+
+	return time.UnixMilli(int64(math.Round(sec * 1000))), true
+}
+
+// Remaining returns the time left until the token expires
+func Remaining(claims jwt.MapClaims) time.Duration {
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return 0
+	}
+
+	return time.Until(exp.Time)
+}
+
 func GetClaim(claims map[string]interface{}, claim string) (string, error) {
 	const op = "GetClaim"
 
@@ -80,22 +380,15 @@ func GetClaim(claims map[string]interface{}, claim string) (string, error) {
 	return res, nil
 }
 
-func ExtractClaimsFromHeader(r *http.Request, secret string) (jwt.MapClaims, error) {
+func ExtractClaimsFromHeader(r *http.Request, keys *KeySet) (jwt.MapClaims, error) {
 	const op = "ExtractClaimsFromHeader"
 
 	tokenString := jwtauth.TokenFromHeader(r)
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+	claims, err := Parse(tokenString, keys, TypeAccess)
 	if err != nil {
-		if errors.As(err, &jwtauth.ErrExpired) {
-			return nil, fmt.Errorf("%s: %w", op, ErrTokenExpired)
-		}
-		return nil, fmt.Errorf("%s: %w", op, errors.New("failed to parse token"))
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
-
 	return claims, nil
 }
 
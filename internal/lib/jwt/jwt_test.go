@@ -8,8 +8,11 @@ import (
 
 func TestNewAccessToken(t *testing.T) {
 	type args struct {
-		user *models.User
-		cfg  config.Token
+		user      *models.User
+		sessionID string
+		grant     Grant
+		cfg       config.Token
+		keys      *KeySet
 	}
 	tests := []struct {
 		name    string
@@ -21,7 +24,7 @@ func TestNewAccessToken(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := NewAccessToken(tt.args.user, tt.args.cfg)
+			got, err := NewAccessToken(tt.args.user, tt.args.sessionID, tt.args.grant, tt.args.cfg, tt.args.keys)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewAccessToken() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -0,0 +1,411 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+
+	rsaKeyBits = 3072
+	kidSize    = 16
+
+	// minReloadInterval limits reloads triggered by tokens with an unknown kid
+	minReloadInterval = 10 * time.Second
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrUnknownKey           = errors.New("unknown signing key")
+	ErrNoSigningKey         = errors.New("no active signing key")
+)
+
+type KeyStorage interface {
+	SigningKeys(ctx context.Context) ([]models.SigningKey, error)
+	RotateSigningKey(ctx context.Context, key models.SigningKey, rotateBefore, expiresAt time.Time) (bool, error)
+}
+
+type key struct {
+	id        string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	createdAt time.Time
+	// encrypted tells the key was sealed in storage, one which was
+	// readable there may be known to others and is rotated out
+	encrypted bool
+}
+
+// KeySet signs tokens with the newest key and verifies them with any key
+// that may still have signed a token which is not expired yet
+type KeySet struct {
+	storage KeyStorage
+	cfg     config.Token
+
+	mu       sync.RWMutex
+	keys     map[string]*key
+	active   *key
+	loadedAt time.Time
+
+	// reloadMu lets a single request reload the keys when an unknown kid shows up
+	reloadMu sync.Mutex
+}
+
+func NewKeySet(ctx context.Context, storage KeyStorage, cfg config.Token) (*KeySet, error) {
+	const op = "NewKeySet"
+
+	if _, err := signingMethod(cfg.JWT.Algorithm); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ks := &KeySet{
+		storage: storage,
+		cfg:     cfg,
+	}
+
+	err := ks.Rotate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ks, nil
+}
+
+// Run reloads the key set and rotates the signing key when it gets older than
+// the rotation period, until ctx is done
+func (ks *KeySet) Run(ctx context.Context, log *slog.Logger) {
+	const op = "jwt.KeySet.Run"
+
+	log = log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(ks.cfg.JWT.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := ks.Rotate(ctx)
+			if err != nil {
+				log.Error("failed to rotate signing keys", sl.Error(err))
+			}
+		}
+	}
+}
+
+// Rotate generates a new signing key if the active one is older than the rotation
+// period, uses another algorithm or was stored in plaintext, then reloads the key set
+func (ks *KeySet) Rotate(ctx context.Context) error {
+	const op = "Rotate"
+
+	err := ks.load(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	rotateBefore := now.Add(-ks.cfg.JWT.RotationPeriod)
+
+	ks.mu.RLock()
+	active := ks.active
+	ks.mu.RUnlock()
+
+	if active != nil && active.encrypted && active.method.Alg() == ks.cfg.JWT.Algorithm && active.createdAt.After(rotateBefore) {
+		return nil
+	}
+
+	newKey, err := generateKey(ks.cfg.JWT.Algorithm, ks.cfg.JWT.KeyEncryptionKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Retired keys keep verifying until every token they signed is expired
+	_, err = ks.storage.RotateSigningKey(ctx, newKey, rotateBefore, now.Add(ks.maxTokenTTL()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = ks.load(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Sign signs claims with the active key, putting its id in the "kid" header
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	const op = "Sign"
+
+	ks.mu.RLock()
+	active := ks.active
+	ks.mu.RUnlock()
+
+	if active == nil {
+		return "", fmt.Errorf("%s: %w", op, ErrNoSigningKey)
+	}
+
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.id
+
+	tokenString, err := token.SignedString(active.private)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokenString, nil
+}
+
+// Keyfunc resolves the verification key of a token by its "kid" header
+func (ks *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	k, ok := ks.key(kid)
+	if !ok {
+		// The key may have been rotated in by another replica
+		if err := ks.reloadIfStale(); err != nil {
+			return nil, err
+		}
+		k, ok = ks.key(kid)
+	}
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return k.private.Public(), nil
+}
+
+// ValidMethods lists the algorithms tokens may be signed with
+func (ks *KeySet) ValidMethods() []string {
+	return []string{AlgRS256, AlgES256, AlgEdDSA}
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public part of every verification key as a JSON Web Key Set
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		jwk := JWK{
+			Kid: k.id,
+			Use: "sig",
+			Alg: k.method.Alg(),
+		}
+
+		switch pub := k.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeBase64(pub.N.Bytes())
+			jwk.E = encodeBase64(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = encodeBase64(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = encodeBase64(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = encodeBase64(pub)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func (ks *KeySet) load(ctx context.Context) error {
+	stored, err := ks.storage.SigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*key, len(stored))
+	var active *key
+	for _, sk := range stored {
+		k, err := parseKey(sk, ks.cfg.JWT.KeyEncryptionKey)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", sk.ID, err)
+		}
+		keys[k.id] = k
+
+		if sk.RetiredAt == nil && (active == nil || k.createdAt.After(active.createdAt)) {
+			active = k
+		}
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.active = active
+	ks.loadedAt = time.Now()
+	ks.mu.Unlock()
+
+	return nil
+}
+
+func (ks *KeySet) key(kid string) (*key, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+func (ks *KeySet) reloadIfStale() error {
+	ks.reloadMu.Lock()
+	defer ks.reloadMu.Unlock()
+
+	ks.mu.RLock()
+	stale := time.Since(ks.loadedAt) > minReloadInterval
+	ks.mu.RUnlock()
+
+	if !stale {
+		return nil
+	}
+
+	return ks.load(context.Background())
+}
+
+// maxTokenTTL is the longest lifetime of any token signed by the key set
+func (ks *KeySet) maxTokenTTL() time.Duration {
+	return max(ks.cfg.JWT.TTL, ks.cfg.Refresh.TTL, ks.cfg.Verification.TTL, ks.cfg.MFA.TTL)
+}
+
+// generateKey returns a new key of alg, sealed with kek under its id
+func generateKey(alg string, kek []byte) (models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return models.SigningKey{}, ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	kid, err := secret.New(kidSize)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	// Sealed under its id, so that the key of one row can't be passed off as another's
+	sealed, err := secret.Seal(kek, der, []byte(kid))
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	return models.SigningKey{
+		ID:         kid,
+		Algorithm:  alg,
+		PrivateKey: sealed,
+		Encrypted:  true,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+func parseKey(sk models.SigningKey, kek []byte) (*key, error) {
+	method, err := signingMethod(sk.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	der := sk.PrivateKey
+	if sk.Encrypted {
+		der, err = secret.Open(kek, sk.PrivateKey, []byte(sk.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return &key{
+		id:        sk.ID,
+		method:    method,
+		private:   private,
+		createdAt: sk.CreatedAt,
+		encrypted: sk.Encrypted,
+	}, nil
+}
+
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case AlgRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgES256:
+		return jwt.SigningMethodES256, nil
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,207 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// memoryKeyStorage mimics storage.postgres key rotation in memory
+type memoryKeyStorage struct {
+	keys []models.SigningKey
+}
+
+func (m *memoryKeyStorage) SigningKeys(_ context.Context) ([]models.SigningKey, error) {
+	var res []models.SigningKey
+	for _, k := range m.keys {
+		if k.ExpiresAt == nil || k.ExpiresAt.After(time.Now()) {
+			res = append(res, k)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt.After(res[j].CreatedAt) })
+	return res, nil
+}
+
+func (m *memoryKeyStorage) RotateSigningKey(_ context.Context, key models.SigningKey, rotateBefore, expiresAt time.Time) (bool, error) {
+	for _, k := range m.keys {
+		if k.RetiredAt == nil && k.Encrypted && k.Algorithm == key.Algorithm && k.CreatedAt.After(rotateBefore) {
+			return false, nil
+		}
+	}
+
+	now := time.Now()
+	for i := range m.keys {
+		if m.keys[i].RetiredAt == nil {
+			m.keys[i].RetiredAt = &now
+			m.keys[i].ExpiresAt = &expiresAt
+		}
+	}
+	m.keys = append(m.keys, key)
+
+	return true, nil
+}
+
+func testTokenConfig(alg string) config.Token {
+	var cfg config.Token
+	cfg.JWT.TTL = time.Minute
+	cfg.JWT.Algorithm = alg
+	cfg.JWT.RotationPeriod = time.Hour
+	cfg.JWT.KeyEncryptionKey = bytes.Repeat([]byte{0x5e}, secret.KeySize)
+	cfg.Refresh.TTL = time.Hour
+
+	return cfg
+}
+
+func TestKeySetSignAndParse(t *testing.T) {
+	user := &models.User{UUID: "0d5ba1c8-3b2f-4d6e-9a55-0f0c8c3f7a10", Role: models.RoleUser}
+
+	for _, alg := range []string{AlgRS256, AlgES256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			cfg := testTokenConfig(alg)
+
+			keys, err := NewKeySet(context.Background(), &memoryKeyStorage{}, cfg)
+			if err != nil {
+				t.Fatalf("NewKeySet() error = %v", err)
+			}
+
+			token, err := NewAccessToken(user, "session", Grant{}, cfg, keys)
+			if err != nil {
+				t.Fatalf("NewAccessToken() error = %v", err)
+			}
+
+			claims, err := Parse(token, keys, TypeAccess)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if claims["sub"] != user.UUID {
+				t.Errorf("Parse() sub = %v, want %v", claims["sub"], user.UUID)
+			}
+
+			if _, err := Parse(token, keys, TypeRefresh); err == nil {
+				t.Errorf("Parse() accepted an access token as a refresh token")
+			}
+
+			untyped, err := keys.Sign(jwt.MapClaims{"sub": user.UUID, "exp": time.Now().Add(time.Minute).Unix()})
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if _, err := Parse(untyped, keys, TypeAccess); !errors.Is(err, ErrInvalidTokenType) {
+				t.Errorf("Parse() of a token without typ error = %v, want %v", err, ErrInvalidTokenType)
+			}
+
+			jwks := keys.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Alg != alg {
+				t.Errorf("JWKS() = %+v, want one %s key", jwks, alg)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	cfg := testTokenConfig(AlgES256)
+	storage := &memoryKeyStorage{}
+	user := &models.User{UUID: "0d5ba1c8-3b2f-4d6e-9a55-0f0c8c3f7a10"}
+
+	keys, err := NewKeySet(context.Background(), storage, cfg)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	oldToken, err := NewRefreshToken(user, "session", "jti", Grant{}, cfg, keys)
+	if err != nil {
+		t.Fatalf("NewRefreshToken() error = %v", err)
+	}
+
+	// Switching the algorithm forces a rotation
+	cfg.JWT.Algorithm = AlgEdDSA
+	keys.cfg = cfg
+	if err := keys.Rotate(context.Background()); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+
+	if len(storage.keys) != 2 || storage.keys[0].RetiredAt == nil {
+		t.Fatalf("Rotate() did not retire the old key: %+v", storage.keys)
+	}
+
+	if _, err := Parse(oldToken, keys, TypeRefresh); err != nil {
+		t.Errorf("Parse() of a token signed with a retired key error = %v", err)
+	}
+
+	newToken, err := NewRefreshToken(user, "session", "jti", Grant{}, cfg, keys)
+	if err != nil {
+		t.Fatalf("NewRefreshToken() error = %v", err)
+	}
+	if _, err := Parse(newToken, keys, TypeRefresh); err != nil {
+		t.Errorf("Parse() of a token signed with the new key error = %v", err)
+	}
+
+	if n := len(keys.JWKS().Keys); n != 2 {
+		t.Errorf("JWKS() has %d keys, want 2", n)
+	}
+
+	// Once every token signed with it is expired, the old key is dropped
+	past := time.Now().Add(-time.Second)
+	storage.keys[0].ExpiresAt = &past
+	if err := keys.Rotate(context.Background()); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if _, err := Parse(oldToken, keys, TypeRefresh); err == nil {
+		t.Errorf("Parse() accepted a token signed with an expired key")
+	}
+}
+
+func TestKeySetSealsKeys(t *testing.T) {
+	cfg := testTokenConfig(AlgES256)
+
+	// A key stored before keys were sealed
+	legacy, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &memoryKeyStorage{keys: []models.SigningKey{
+		{ID: "legacy", Algorithm: AlgES256, PrivateKey: der, CreatedAt: time.Now()},
+	}}
+
+	keys, err := NewKeySet(context.Background(), storage, cfg)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	if len(storage.keys) != 2 || storage.keys[0].RetiredAt == nil {
+		t.Fatalf("NewKeySet() did not retire the plaintext key: %+v", storage.keys)
+	}
+
+	sealed := storage.keys[1]
+	if !sealed.Encrypted {
+		t.Fatalf("new key is not encrypted")
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(sealed.PrivateKey); err == nil {
+		t.Errorf("new key is stored in plaintext")
+	}
+	if keys.active == nil || keys.active.id != sealed.ID {
+		t.Errorf("active key = %v, want %s", keys.active, sealed.ID)
+	}
+
+	// Keys sealed with another key don't load
+	cfg.JWT.KeyEncryptionKey = bytes.Repeat([]byte{0x3c}, secret.KeySize)
+	if _, err := NewKeySet(context.Background(), storage, cfg); !errors.Is(err, secret.ErrCannotOpen) {
+		t.Errorf("NewKeySet() with another encryption key error = %v, want %v", err, secret.ErrCannotOpen)
+	}
+}
@@ -0,0 +1,90 @@
+package jwt
+
+import (
+	"context"
+	"time"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Denylist knows which tokens were revoked before they expired
+type Denylist interface {
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+	IsSessionRevoked(ctx context.Context, sid string) (bool, error)
+	UserTokensRevokedAt(ctx context.Context, uuid string) (time.Time, error)
+}
+
+// Revoker revokes tokens before they expire
+type Revoker interface {
+	RevokeTokens(ctx context.Context, tokens map[string]time.Duration) error
+	RevokeUserTokens(ctx context.Context, uuid string, ttl time.Duration) error
+}
+
+// SessionStorage ends the sessions of users
+type SessionStorage interface {
+	RevokeSessions(ctx context.Context, uuid string) ([]models.Session, error)
+}
+
+// Revoked reports whether the token of user uuid was revoked by its id, along with
+// the rest of its session or along with every token of the user
+func Revoked(ctx context.Context, denylist Denylist, uuid string, claims jwt.MapClaims) (bool, error) {
+	// Tokens issued before they had ids and sessions can only be revoked with the rest of the user's
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		revoked, err := denylist.IsTokenRevoked(ctx, jti)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	if sid, ok := claims["sid"].(string); ok && sid != "" {
+		revoked, err := denylist.IsSessionRevoked(ctx, sid)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	revokedAt, err := denylist.UserTokensRevokedAt(ctx, uuid)
+	if err != nil {
+		return false, err
+	}
+
+	return !revokedAt.IsZero() && IssuedBefore(claims, revokedAt), nil
+}
+
+// FamilyID returns the session a refresh token belongs to. Tokens issued before
+// token families name it "sid", the ones issued before sessions have none.
+func FamilyID(claims jwt.MapClaims) string {
+	if id, ok := claims["family_id"].(string); ok {
+		return id
+	}
+
+	id, _ := claims["sid"].(string)
+	return id
+}
+
+// EndSessions ends every session of the user uuid and revokes all the tokens issued to them so far
+func EndSessions(ctx context.Context, storage SessionStorage, revoker Revoker, uuid string, cfg config.Token) error {
+	sessions, err := storage.RevokeSessions(ctx, uuid)
+	if err != nil {
+		return err
+	}
+
+	// Latest refresh tokens of the sessions, the older ones are rejected by rotation anyway
+	tokens := make(map[string]time.Duration, len(sessions))
+	for _, ss := range sessions {
+		if ss.RefreshJTI != "" {
+			tokens[ss.RefreshJTI] = time.Until(ss.ExpiresAt)
+		}
+	}
+
+	err = revoker.RevokeTokens(ctx, tokens)
+	if err != nil {
+		return err
+	}
+
+	// Covers access tokens and refresh tokens issued before sessions were introduced
+	return revoker.RevokeUserTokens(ctx, uuid, max(cfg.JWT.TTL, cfg.Refresh.TTL))
+}
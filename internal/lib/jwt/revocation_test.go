@@ -0,0 +1,103 @@
+package jwt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"user-management-service/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type denylist struct {
+	tokens    map[string]bool
+	sessions  map[string]bool
+	revokedAt time.Time
+}
+
+func (d denylist) IsTokenRevoked(_ context.Context, id string) (bool, error) {
+	return d.tokens[id], nil
+}
+
+func (d denylist) IsSessionRevoked(_ context.Context, sid string) (bool, error) {
+	return d.sessions[sid], nil
+}
+
+func (d denylist) UserTokensRevokedAt(_ context.Context, _ string) (time.Time, error) {
+	return d.revokedAt, nil
+}
+
+func TestRevoked(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	claims := jwt.MapClaims{"jti": "token", "sid": "session", "iat": numericDate(now)}
+	// Tokens of older releases were issued with a whole second "iat"
+	second := now.Truncate(time.Second)
+	legacy := jwt.MapClaims{"iat": float64(second.Unix())}
+
+	tests := []struct {
+		name     string
+		denylist denylist
+		claims   jwt.MapClaims
+		want     bool
+	}{
+		{name: "not revoked", claims: claims, want: false},
+		{name: "token revoked", denylist: denylist{tokens: map[string]bool{"token": true}}, claims: claims, want: true},
+		{name: "session revoked", denylist: denylist{sessions: map[string]bool{"session": true}}, claims: claims, want: true},
+		{name: "user tokens revoked after issue", denylist: denylist{revokedAt: now.Add(time.Millisecond)}, claims: claims, want: true},
+		{name: "user tokens revoked in the millisecond of issue", denylist: denylist{revokedAt: now}, claims: claims, want: true},
+		{name: "user tokens revoked a millisecond before issue", denylist: denylist{revokedAt: now.Add(-time.Millisecond)}, claims: claims, want: false},
+		{name: "user tokens revoked before issue", denylist: denylist{revokedAt: now.Add(-time.Second)}, claims: claims, want: false},
+		{name: "whole second token revoked in its second", denylist: denylist{revokedAt: second.Add(999 * time.Millisecond)}, claims: legacy, want: true},
+		{name: "whole second token revoked before its second", denylist: denylist{revokedAt: second.Add(-time.Millisecond)}, claims: legacy, want: false},
+		{name: "legacy token after user tokens revoked", denylist: denylist{revokedAt: now}, claims: jwt.MapClaims{}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Revoked(context.Background(), tt.denylist, "uuid", tt.claims)
+			if err != nil {
+				t.Fatalf("Revoked() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Revoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokedRightAfterMark(t *testing.T) {
+	user := &models.User{UUID: "0d5ba1c8-3b2f-4d6e-9a55-0f0c8c3f7a10", Role: models.RoleUser}
+	cfg := testTokenConfig(AlgES256)
+
+	keys, err := NewKeySet(context.Background(), &memoryKeyStorage{}, cfg)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	issue := func() jwt.MapClaims {
+		token, err := NewAccessToken(user, "session", Grant{}, cfg, keys)
+		if err != nil {
+			t.Fatalf("NewAccessToken() error = %v", err)
+		}
+		claims, err := Parse(token, keys, TypeAccess)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		return claims
+	}
+
+	before := issue()
+	time.Sleep(2 * time.Millisecond)
+	mark := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	// Most likely in the same second as the mark, e.g. the tokens of a login after a password reset
+	after := issue()
+
+	d := denylist{revokedAt: mark}
+	if revoked, _ := Revoked(context.Background(), d, user.UUID, before); !revoked {
+		t.Error("token issued before the mark is not revoked")
+	}
+	if revoked, _ := Revoked(context.Background(), d, user.UUID, after); revoked {
+		t.Error("token issued right after the mark is revoked")
+	}
+}
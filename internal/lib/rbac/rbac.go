@@ -0,0 +1,73 @@
+package rbac
+
+import (
+	"slices"
+
+	"user-management-service/internal/models"
+)
+
+type Permission string
+
+const (
+	// MeRead lets a personal access token read its user's own account,
+	// which any other token of the user may do anyway
+	MeRead Permission = "me:read"
+
+	UsersRead   Permission = "users:read"
+	UsersWrite  Permission = "users:write"
+	UsersDelete Permission = "users:delete"
+	UsersBlock  Permission = "users:block"
+
+	GroupsRead  Permission = "groups:read"
+	GroupsWrite Permission = "groups:write"
+
+	OAuthClientsManage    Permission = "oauth_clients:manage"
+	ServiceAccountsManage Permission = "service_accounts:manage"
+)
+
+// permissions maps every role to the actions it may perform on resources of
+// other users, and on its own account where personal access tokens need a scope for it
+var permissions = map[string][]Permission{
+	models.RoleUser: {
+		MeRead,
+	},
+	models.RoleModerator: {
+		MeRead,
+		UsersRead,
+		UsersBlock,
+		GroupsRead,
+	},
+	models.RoleAdmin: {
+		MeRead,
+		UsersRead,
+		UsersWrite,
+		UsersDelete,
+		UsersBlock,
+		GroupsRead,
+		GroupsWrite,
+		OAuthClientsManage,
+		ServiceAccountsManage,
+	},
+}
+
+// ranks order the roles, a role may only act on users of a lower one
+var ranks = map[string]int{
+	models.RoleUser:      1,
+	models.RoleModerator: 2,
+	models.RoleAdmin:     3,
+}
+
+// Outranks reports whether role is above other. Unknown roles are below every known one.
+func Outranks(role, other string) bool {
+	return ranks[role] > ranks[other]
+}
+
+// Can reports whether role is granted perm. Unknown roles are granted nothing.
+func Can(role string, perm Permission) bool {
+	return slices.Contains(permissions[role], perm)
+}
+
+// Permissions returns every permission granted to role
+func Permissions(role string) []Permission {
+	return slices.Clone(permissions[role])
+}
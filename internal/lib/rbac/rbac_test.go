@@ -0,0 +1,59 @@
+package rbac
+
+import (
+	"testing"
+
+	"user-management-service/internal/models"
+)
+
+func TestOutranks(t *testing.T) {
+	tests := []struct {
+		name  string
+		role  string
+		other string
+		want  bool
+	}{
+		{name: "admin outranks moderator", role: models.RoleAdmin, other: models.RoleModerator, want: true},
+		{name: "moderator outranks user", role: models.RoleModerator, other: models.RoleUser, want: true},
+		{name: "moderator doesn't outrank admin", role: models.RoleModerator, other: models.RoleAdmin, want: false},
+		{name: "equal roles", role: models.RoleAdmin, other: models.RoleAdmin, want: false},
+		{name: "unknown role", role: "root", other: models.RoleUser, want: false},
+		{name: "over unknown role", role: models.RoleUser, other: "root", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Outranks(tt.role, tt.other); got != tt.want {
+				t.Errorf("Outranks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		name string
+		role string
+		perm Permission
+		want bool
+	}{
+		{name: "admin deletes users", role: models.RoleAdmin, perm: UsersDelete, want: true},
+		{name: "moderator blocks users", role: models.RoleModerator, perm: UsersBlock, want: true},
+		{name: "moderator can't delete users", role: models.RoleModerator, perm: UsersDelete, want: false},
+		{name: "user reads own account", role: models.RoleUser, perm: MeRead, want: true},
+		{name: "user can't read other users", role: models.RoleUser, perm: UsersRead, want: false},
+		{name: "moderator reads groups", role: models.RoleModerator, perm: GroupsRead, want: true},
+		{name: "moderator can't manage groups", role: models.RoleModerator, perm: GroupsWrite, want: false},
+		{name: "admin manages oauth clients", role: models.RoleAdmin, perm: OAuthClientsManage, want: true},
+		{name: "moderator can't manage oauth clients", role: models.RoleModerator, perm: OAuthClientsManage, want: false},
+		{name: "admin manages service accounts", role: models.RoleAdmin, perm: ServiceAccountsManage, want: true},
+		{name: "moderator can't manage service accounts", role: models.RoleModerator, perm: ServiceAccountsManage, want: false},
+		{name: "unknown role", role: "root", perm: UsersRead, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Can(tt.role, tt.perm); got != tt.want {
+				t.Errorf("Can() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
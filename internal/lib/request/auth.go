@@ -0,0 +1,47 @@
+package request
+
+// SignUp is the body of POST /auth/signup
+type SignUp struct {
+	Username string `json:"username" validate:"required,username"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+// Login is the body of POST /auth/login. Credentials aren't checked against the
+// signup rules, users signed up before them must still be able to log in.
+type Login struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// LoginMFA is the body of POST /auth/login/mfa
+type LoginMFA struct {
+	Token string `json:"mfaToken" validate:"required"`
+	Code  string `json:"code" validate:"required"`
+}
+
+// RefreshToken is the body of POST /auth/refresh-token, /auth/logout and /auth/logout-all
+type RefreshToken struct {
+	Token string `json:"refreshToken" validate:"required"`
+}
+
+// Email is the body of POST /auth/reset-password and /auth/resend-verification
+type Email struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ConfirmResetPassword is the body of POST /auth/reset-password/confirm
+type ConfirmResetPassword struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+// VerifyEmail is the body of POST /auth/verify-email
+type VerifyEmail struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// MFACode is the body of the /users/me/mfa endpoints asking for a current code
+type MFACode struct {
+	Code string `json:"code" validate:"required"`
+}
@@ -0,0 +1,33 @@
+package request
+
+import "time"
+
+// CreatePersonalToken is the body of POST /users/me/tokens
+type CreatePersonalToken struct {
+	Name      string     `json:"name" validate:"required,max=255"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// CreateServiceAccount is the body of POST /admin/service-accounts, the role defaults to user
+type CreateServiceAccount struct {
+	Name         string `json:"name" validate:"required,max=255"`
+	Description  string `json:"description" validate:"max=1000"`
+	Role         string `json:"role" validate:"oneof=user moderator admin"`
+	OwnerGroupID string `json:"ownerGroupId"`
+	PublicKey    string `json:"publicKey"`
+}
+
+// CreateOAuthClient is the body of POST /admin/oauth/clients
+type CreateOAuthClient struct {
+	Name         string   `json:"name" validate:"required,max=255"`
+	RedirectURIs []string `json:"redirectUris"`
+	GrantTypes   []string `json:"grantTypes"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+// Consent is the body of POST /oauth/authorize, the user's answer to a client
+type Consent struct {
+	Approve bool `json:"approve"`
+}
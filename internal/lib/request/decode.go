@@ -0,0 +1,122 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	resp "user-management-service/internal/lib/response"
+)
+
+// MaxBodySize limits the JSON bodies read by Decode, none of the requests comes close
+const MaxBodySize = 64 << 10
+
+var ErrBodyTooLarge = errors.New("request body is too large")
+
+// MalformedError is a body that can't be read into the request at all
+type MalformedError struct {
+	Detail string
+	Err    error
+}
+
+func (e *MalformedError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Detail, e.Err)
+}
+
+func (e *MalformedError) Unwrap() error {
+	return e.Err
+}
+
+// Decode reads the JSON body of r into dst, rejecting unknown fields, trailing data
+// and bodies over MaxBodySize, then checks dst against the rules of its validate tags.
+func Decode(w http.ResponseWriter, r *http.Request, dst any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		return decodeError(err)
+	}
+	if dec.More() {
+		return &MalformedError{Detail: "request body must hold a single JSON object", Err: errors.New("trailing data")}
+	}
+
+	return Validate(dst)
+}
+
+func decodeError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return fmt.Errorf("%w: %v", ErrBodyTooLarge, err)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return &ValidationError{Fields: []resp.FieldError{{
+			Field:   typeErr.Field,
+			Code:    CodeInvalidType,
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, jsonType(typeErr.Type.Kind())),
+		}}}
+	}
+
+	var timeErr *time.ParseError
+	if errors.As(err, &timeErr) {
+		return &MalformedError{Detail: "times must be in RFC 3339 format", Err: err}
+	}
+
+	// The decoder has no error type of its own for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return &MalformedError{Detail: "unknown field " + field, Err: err}
+	}
+
+	if errors.Is(err, io.EOF) {
+		return &MalformedError{Detail: "request body is empty", Err: err}
+	}
+
+	return &MalformedError{Detail: "request body is not valid JSON", Err: err}
+}
+
+// jsonType names the JSON type a Go value of kind is decoded from
+func jsonType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return "valid value"
+	}
+}
+
+// RenderError renders the problem of an error returned by Decode
+func RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		resp.Invalid(w, r, validationErr.Fields...)
+		return
+	}
+
+	if errors.Is(err, ErrBodyTooLarge) {
+		resp.Error(w, r, http.StatusRequestEntityTooLarge, resp.CodeRequestTooLarge, ErrBodyTooLarge.Error())
+		return
+	}
+
+	var malformedErr *MalformedError
+	if errors.As(err, &malformedErr) {
+		resp.BadRequest(w, r, malformedErr.Detail)
+		return
+	}
+
+	resp.BadRequest(w, r, "invalid request body")
+}
@@ -0,0 +1,60 @@
+package request
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	resp "user-management-service/internal/lib/response"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "valid", body: `{"username":"john","password":"secret"}`, wantStatus: http.StatusOK},
+		{name: "unknown field", body: `{"username":"john","password":"secret","role":"admin"}`, wantStatus: http.StatusBadRequest, wantCode: resp.CodeInvalidRequest},
+		{name: "malformed", body: `{"username":`, wantStatus: http.StatusBadRequest, wantCode: resp.CodeInvalidRequest},
+		{name: "empty", body: ``, wantStatus: http.StatusBadRequest, wantCode: resp.CodeInvalidRequest},
+		{name: "trailing data", body: `{"username":"john","password":"secret"} {}`, wantStatus: http.StatusBadRequest, wantCode: resp.CodeInvalidRequest},
+		{name: "wrong type", body: `{"username":1,"password":"secret"}`, wantStatus: http.StatusUnprocessableEntity, wantCode: resp.CodeValidationFailed},
+		{name: "missing fields", body: `{}`, wantStatus: http.StatusUnprocessableEntity, wantCode: resp.CodeValidationFailed},
+		{name: "too large", body: `{"username":"` + strings.Repeat("a", MaxBodySize) + `"}`, wantStatus: http.StatusRequestEntityTooLarge, wantCode: resp.CodeRequestTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			var req Login
+			err := Decode(w, r, &req)
+			if tt.wantStatus == http.StatusOK {
+				if err != nil {
+					t.Fatalf("Decode() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Decode() error = nil, want an error")
+			}
+
+			RenderError(w, r, err)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			var p resp.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("failed to decode problem: %v", err)
+			}
+			if p.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", p.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package request
+
+// CreateGroup is the body of POST /groups
+type CreateGroup struct {
+	Name        string `json:"name" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=1000"`
+}
+
+// UpdateGroup is the body of PATCH /groups/{id}, nil fields are left untouched
+type UpdateGroup struct {
+	Name        *string `json:"name" validate:"min=1,max=255"`
+	Description *string `json:"description" validate:"max=1000"`
+}
@@ -1 +1,39 @@
 package request
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+
+	"user-management-service/internal/models"
+
+	"github.com/go-chi/chi"
+)
+
+// uuidPattern is the text form of a UUID as Postgres writes them
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// UUIDParam returns the URL parameter name and reports whether it is a UUID.
+// Anything else names no resource, and is not to reach a UUID column.
+func UUIDParam(r *http.Request, name string) (string, bool) {
+	id := chi.URLParam(r, name)
+	return id, IsUUID(id)
+}
+
+// IsUUID reports whether s is a UUID
+func IsUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// Client describes the device the request comes from
+func Client(r *http.Request) models.Client {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return models.Client{
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	}
+}
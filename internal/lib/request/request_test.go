@@ -0,0 +1,38 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestUUIDParam(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		wantOK bool
+	}{
+		{name: "uuid", id: "0d5ba1c8-3b2f-4d6e-9a55-0f0c8c3f7a10", wantOK: true},
+		{name: "upper case", id: "0D5BA1C8-3B2F-4D6E-9A55-0F0C8C3F7A10", wantOK: true},
+		{name: "empty", id: ""},
+		{name: "not hex", id: "0d5ba1c8-3b2f-4d6e-9a55-0f0c8c3f7a1z"},
+		{name: "no hyphens", id: "0d5ba1c83b2f4d6e9a550f0c8c3f7a10"},
+		{name: "injection", id: "1' OR '1'='1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("uuid", tt.id)
+			r := httptest.NewRequest(http.MethodGet, "/admin/users/x", nil)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			id, ok := UUIDParam(r, "uuid")
+			if id != tt.id || ok != tt.wantOK {
+				t.Errorf("UUIDParam() = %q, %v, want %q, %v", id, ok, tt.id, tt.wantOK)
+			}
+		})
+	}
+}
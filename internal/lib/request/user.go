@@ -0,0 +1,27 @@
+package request
+
+import "time"
+
+// PatchUser is the body of PATCH /users/me, empty fields are left untouched
+type PatchUser struct {
+	Name        string `json:"name" validate:"max=100"`
+	Surname     string `json:"surname" validate:"max=100"`
+	Username    string `json:"username" validate:"username"`
+	PhoneNumber string `json:"phone_number" validate:"phone"`
+}
+
+// UpdateUser is the body of PATCH /admin/users/{uuid}, nil fields are left untouched
+type UpdateUser struct {
+	Name        *string `json:"name" validate:"max=100"`
+	Surname     *string `json:"surname" validate:"max=100"`
+	Username    *string `json:"username" validate:"username"`
+	PhoneNumber *string `json:"phone_number" validate:"phone"`
+	Email       *string `json:"email" validate:"email"`
+	Role        *string `json:"role" validate:"oneof=user moderator admin"`
+}
+
+// BlockUser is the body of POST /admin/users/{uuid}/block
+type BlockUser struct {
+	Reason string     `json:"reason" validate:"required,max=500"`
+	Until  *time.Time `json:"until"`
+}
@@ -0,0 +1,215 @@
+package request
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	resp "user-management-service/internal/lib/response"
+)
+
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+	MinPasswordLength = 8
+	// MaxPasswordLength is what bcrypt hashes, it refuses longer passwords
+	MaxPasswordLength = 72
+	MaxEmailLength    = 254
+)
+
+// Codes of the field errors, on top of resp.Required's
+const (
+	CodeInvalidType     = "invalid_type"
+	CodeInvalidEmail    = "invalid_email"
+	CodeInvalidPhone    = "invalid_phone"
+	CodeInvalidUsername = "invalid_username"
+	CodeTooShort        = "too_short"
+	CodeTooLong         = "too_long"
+	CodeNotAllowed      = "not_allowed"
+)
+
+var (
+	// e164 is an international phone number of up to 15 digits (ITU-T E.164)
+	e164     = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	username = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+)
+
+// ValidationError lists every field of the request that breaks a rule
+type ValidationError struct {
+	Fields []resp.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+	}
+
+	return "invalid request: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the fields of the struct v points to against the comma separated
+// rules of their validate tags, and reports all the broken ones at once:
+//
+//	required    the field is set and not empty
+//	email       an email address
+//	phone       an E.164 phone number, such as +14155552671
+//	username    MinUsernameLength to MaxUsernameLength letters, digits, '.', '_' or '-'
+//	password    MinPasswordLength to MaxPasswordLength bytes
+//	min=n max=n at least or at most n characters, or elements of a list
+//	oneof=a b   one of the space separated values
+//
+// Rules other than required are skipped for fields left empty, but not for pointers
+// set to an empty value. Fields are named after their json tag.
+func Validate(v any) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []resp.FieldError
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		rules, ok := f.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = f.Name
+		}
+
+		if fe, ok := validateField(name, rv.Field(i), rules); !ok {
+			fields = append(fields, fe)
+		}
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+// validateField checks value against rules and stops at the first broken one
+func validateField(name string, value reflect.Value, rules string) (resp.FieldError, bool) {
+	// A nil pointer is a field left out, a pointer to an empty value is one set to
+	// empty, which is checked like any other value
+	empty := value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0)
+	if value.Kind() == reflect.Pointer && !value.IsNil() {
+		value, empty = value.Elem(), false
+	}
+
+	if empty {
+		if slices.Contains(strings.Split(rules, ","), "required") {
+			return resp.Required(name), false
+		}
+		return resp.FieldError{}, true
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		rule, arg, _ := strings.Cut(rule, "=")
+
+		var fe resp.FieldError
+		switch rule {
+		case "required":
+			continue
+		case "email":
+			fe = checkEmail(name, value.String())
+		case "phone":
+			if !e164.MatchString(value.String()) {
+				fe = resp.FieldError{Code: CodeInvalidPhone, Message: name + " must be a phone number in E.164 format, such as +14155552671"}
+			}
+		case "username":
+			fe = checkUsername(name, value.String())
+		case "password":
+			fe = checkLength(name, len(value.String()), MinPasswordLength, MaxPasswordLength, "bytes")
+		case "min":
+			fe = checkLength(name, length(value), mustAtoi(arg), -1, unit(value))
+		case "max":
+			fe = checkLength(name, length(value), 0, mustAtoi(arg), unit(value))
+		case "oneof":
+			allowed := strings.Fields(arg)
+			if !slices.Contains(allowed, value.String()) {
+				fe = resp.FieldError{Code: CodeNotAllowed, Message: fmt.Sprintf("%s must be one of %s", name, strings.Join(allowed, ", "))}
+			}
+		default:
+			panic(fmt.Sprintf("request: unknown validation rule %q of %s", rule, name))
+		}
+		if fe.Code != "" {
+			fe.Field = name
+			return fe, false
+		}
+	}
+
+	return resp.FieldError{}, true
+}
+
+func checkEmail(name, value string) resp.FieldError {
+	if len(value) > MaxEmailLength {
+		return resp.FieldError{Code: CodeTooLong, Message: fmt.Sprintf("%s must be at most %d characters", name, MaxEmailLength)}
+	}
+
+	// ParseAddress takes display names and comments too, only a bare address is wanted
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value || addr.Name != "" {
+		return resp.FieldError{Code: CodeInvalidEmail, Message: name + " must be an email address"}
+	}
+
+	return resp.FieldError{}
+}
+
+func checkUsername(name, value string) resp.FieldError {
+	fe := checkLength(name, utf8.RuneCountInString(value), MinUsernameLength, MaxUsernameLength, "characters")
+	if fe.Code != "" {
+		return fe
+	}
+	if !username.MatchString(value) {
+		return resp.FieldError{Code: CodeInvalidUsername, Message: name + " may only contain letters, digits, '.', '_' and '-'"}
+	}
+
+	return resp.FieldError{}
+}
+
+// checkLength checks n is within least and most, a negative most is no limit
+func checkLength(name string, n, least, most int, unit string) resp.FieldError {
+	if n < least {
+		return resp.FieldError{Code: CodeTooShort, Message: fmt.Sprintf("%s must be at least %d %s", name, least, unit)}
+	}
+	if most >= 0 && n > most {
+		return resp.FieldError{Code: CodeTooLong, Message: fmt.Sprintf("%s must be at most %d %s", name, most, unit)}
+	}
+
+	return resp.FieldError{}
+}
+
+func length(value reflect.Value) int {
+	if value.Kind() == reflect.String {
+		return utf8.RuneCountInString(value.String())
+	}
+
+	return value.Len()
+}
+
+func unit(value reflect.Value) string {
+	if value.Kind() == reflect.String {
+		return "characters"
+	}
+
+	return "elements"
+}
+
+// mustAtoi parses the argument of a rule, which is part of the code, not of the request
+func mustAtoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		panic(fmt.Sprintf("request: invalid validation rule argument %q", s))
+	}
+
+	return n
+}
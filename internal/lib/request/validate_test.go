@@ -0,0 +1,61 @@
+package request
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	empty := ""
+	role := "root"
+
+	tests := []struct {
+		name       string
+		v          any
+		wantFields map[string]string
+	}{
+		{name: "valid signup", v: &SignUp{Username: "john.doe", Email: "john@example.com", Password: "correct horse"}},
+		{name: "all fields at once", v: &SignUp{}, wantFields: map[string]string{"username": "required", "email": "required", "password": "required"}},
+		{name: "invalid signup", v: &SignUp{Username: "john doe", Email: "John <john@example.com>", Password: "short"}, wantFields: map[string]string{"username": CodeInvalidUsername, "email": CodeInvalidEmail, "password": CodeTooShort}},
+		{name: "short username", v: &SignUp{Username: "jd", Email: "john@example.com", Password: "correct horse"}, wantFields: map[string]string{"username": CodeTooShort}},
+		{name: "password longer than bcrypt takes", v: &ConfirmResetPassword{Token: "t", Password: strings.Repeat("a", MaxPasswordLength+1)}, wantFields: map[string]string{"password": CodeTooLong}},
+		{name: "login takes any credentials", v: &Login{Username: "jd", Password: "1"}},
+		{name: "e164 phone", v: &PatchUser{PhoneNumber: "+14155552671"}},
+		{name: "local phone", v: &PatchUser{PhoneNumber: "8 (415) 555-26-71"}, wantFields: map[string]string{"phone_number": CodeInvalidPhone}},
+		{name: "empty patch", v: &PatchUser{}},
+		{name: "pointer left out", v: &UpdateUser{}},
+		{name: "pointer set to empty", v: &UpdateUser{Username: &empty, Email: &empty}, wantFields: map[string]string{"username": CodeTooShort, "email": CodeInvalidEmail}},
+		{name: "value not allowed", v: &UpdateUser{Role: &role}, wantFields: map[string]string{"role": CodeNotAllowed}},
+		{name: "max length", v: &BlockUser{Reason: strings.Repeat("a", 501)}, wantFields: map[string]string{"reason": CodeTooLong}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.v)
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+
+			got := make(map[string]string)
+			for _, f := range validationErr.Fields {
+				got[f.Field] = f.Code
+			}
+			if len(got) != len(tt.wantFields) {
+				t.Errorf("Validate() fields = %v, want %v", got, tt.wantFields)
+			}
+			for field, code := range tt.wantFields {
+				if got[field] != code {
+					t.Errorf("Validate() %s = %q, want %q", field, got[field], code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ContentTypeProblem is the media type of problem details (RFC 7807 3)
+const ContentTypeProblem = "application/problem+json"
+
+// HeaderRequestID carries the id requests are told apart by in logs, it is sent back with every response
+const HeaderRequestID = "X-Request-ID"
+
+// StatusClientClosedRequest answers requests the client gave up on, which no one
+// reads but tells them apart from failures in access logs
+const StatusClientClosedRequest = 499
+
+// Codes clients may rely on to tell errors apart, the details are for humans only
+const (
+	CodeInternal         = "internal_error"
+	CodeInvalidRequest   = "invalid_request"
+	CodeRequestTooLarge  = "request_too_large"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeTimeout          = "timeout"
+	CodeRequestCanceled  = "request_canceled"
+
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeInvalidToken         = "invalid_token"
+	CodeTokenExpired         = "token_expired"
+	CodeTokenRevoked         = "token_revoked"
+	CodeInvalidMFACode       = "invalid_mfa_code"
+	CodeMFAAlreadyEnabled    = "mfa_already_enabled"
+	CodeMFANotEnabled        = "mfa_not_enabled"
+	CodeMFAEnrollmentMissing = "mfa_enrollment_not_started"
+	CodeUserBlocked          = "user_blocked"
+	CodeEmailNotVerified     = "email_not_verified"
+	CodeEmailAlreadyVerified = "email_already_verified"
+	CodeAccountLocked        = "account_locked"
+
+	CodeUserNotFound           = "user_not_found"
+	CodeSessionNotFound        = "session_not_found"
+	CodeGroupNotFound          = "group_not_found"
+	CodePersonalTokenNotFound  = "personal_token_not_found"
+	CodeServiceAccountNotFound = "service_account_not_found"
+	CodeClientNotFound         = "oauth_client_not_found"
+
+	CodeUserExists           = "user_exists"
+	CodeUsernameTaken        = "username_taken"
+	CodeGroupExists          = "group_exists"
+	CodeServiceAccountExists = "service_account_exists"
+)
+
+// Problem is an error response of RFC 7807. Type is left as about:blank,
+// the Code extension tells what went wrong.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError tells what is wrong with a field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error renders the problem of status with code and detail
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	RenderProblem(w, r, Problem{Status: status, Code: code, Detail: detail})
+}
+
+// Internal renders an internal error, whose details are kept from the client
+func Internal(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusInternalServerError, CodeInternal, "internal error")
+}
+
+// Unexpected renders an error clients aren't told about: a timeout or a cancellation
+// of the request, which are no fault of the service, or else an internal error
+func Unexpected(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		Error(w, r, http.StatusGatewayTimeout, CodeTimeout, "operation timed out")
+	case errors.Is(err, context.Canceled):
+		Error(w, r, StatusClientClosedRequest, CodeRequestCanceled, "request canceled")
+	default:
+		Internal(w, r)
+	}
+}
+
+// BadRequest renders a request that could not be read, such as malformed JSON
+func BadRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	Error(w, r, http.StatusBadRequest, CodeInvalidRequest, detail)
+}
+
+// Invalid renders a request whose fields are wrong, all of them at once
+func Invalid(w http.ResponseWriter, r *http.Request, errs ...FieldError) {
+	RenderProblem(w, r, Problem{
+		Status: http.StatusUnprocessableEntity,
+		Code:   CodeValidationFailed,
+		Detail: "request is invalid",
+		Errors: errs,
+	})
+}
+
+// RenderProblem fills in what p leaves out and writes it as application/problem+json
+func RenderProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = statusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = w.Header().Get(HeaderRequestID)
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// statusText is http.StatusText, which knows nothing of StatusClientClosedRequest
+func statusText(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+
+	return http.StatusText(status)
+}
+
+// ErrorCase maps the errors matching Err to a problem of Status and Code, detailed by
+// Detail or else by the message of Err, not of the wrapping error. Errors of a Field
+// of the request are reported in the problem's Errors as well.
+type ErrorCase struct {
+	Err    error
+	Status int
+	Code   string
+	Detail string
+	Field  string
+}
+
+// ErrorMap tells which errors clients are told about, in the order they are tried
+type ErrorMap []ErrorCase
+
+// Render renders the problem of the first case err matches, or else see Unexpected
+func (m ErrorMap) Render(w http.ResponseWriter, r *http.Request, err error) {
+	c, ok := m.find(err)
+	if !ok {
+		Unexpected(w, r, err)
+		return
+	}
+
+	detail := c.Detail
+	if detail == "" {
+		detail = c.Err.Error()
+	}
+
+	p := Problem{Status: c.Status, Code: c.Code, Detail: detail}
+	if c.Field != "" {
+		p.Errors = []FieldError{{Field: c.Field, Code: "invalid", Message: detail}}
+	}
+
+	RenderProblem(w, r, p)
+}
+
+// Has reports whether err is one clients are told about
+func (m ErrorMap) Has(err error) bool {
+	_, ok := m.find(err)
+	return ok
+}
+
+func (m ErrorMap) find(err error) (ErrorCase, bool) {
+	for _, c := range m {
+		if errors.Is(err, c.Err) {
+			return c, true
+		}
+	}
+
+	return ErrorCase{}, false
+}
+
+// Required is the error of a field left empty
+func Required(field string) FieldError {
+	return FieldError{Field: field, Code: "required", Message: field + " is required"}
+}
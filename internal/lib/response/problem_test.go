@@ -0,0 +1,72 @@
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorMapRender(t *testing.T) {
+	errNotFound := errors.New("user not found")
+	errInvalid := errors.New("invalid role")
+	errTaken := errors.New("user already exists")
+
+	m := ErrorMap{
+		{Err: errNotFound, Status: http.StatusNotFound, Code: CodeUserNotFound},
+		{Err: errInvalid, Status: http.StatusUnprocessableEntity, Code: CodeValidationFailed, Field: "role"},
+		{Err: errTaken, Status: http.StatusConflict, Code: CodeUsernameTaken, Detail: "username is taken"},
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+		wantFields int
+	}{
+		{name: "wrapped error", err: fmt.Errorf("service.user.Get: %w", errNotFound), wantStatus: http.StatusNotFound, wantCode: CodeUserNotFound, wantDetail: "user not found"},
+		{name: "field error", err: errInvalid, wantStatus: http.StatusUnprocessableEntity, wantCode: CodeValidationFailed, wantDetail: "invalid role", wantFields: 1},
+		{name: "detail override", err: errTaken, wantStatus: http.StatusConflict, wantCode: CodeUsernameTaken, wantDetail: "username is taken"},
+		{name: "unknown error is kept from the client", err: errors.New("pq: connection refused"), wantStatus: http.StatusInternalServerError, wantCode: CodeInternal, wantDetail: "internal error"},
+		{name: "deadline exceeded", err: fmt.Errorf("service.user.Get: %w", context.DeadlineExceeded), wantStatus: http.StatusGatewayTimeout, wantCode: CodeTimeout, wantDetail: "operation timed out"},
+		{name: "canceled", err: fmt.Errorf("service.user.Get: %w", context.Canceled), wantStatus: StatusClientClosedRequest, wantCode: CodeRequestCanceled, wantDetail: "request canceled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+			w := httptest.NewRecorder()
+			w.Header().Set(HeaderRequestID, "req-1")
+
+			m.Render(w, r, tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != ContentTypeProblem {
+				t.Errorf("Content-Type = %q, want %q", ct, ContentTypeProblem)
+			}
+
+			var p Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("failed to decode problem: %v", err)
+			}
+			if p.Status != tt.wantStatus || p.Code != tt.wantCode || p.Detail != tt.wantDetail {
+				t.Errorf("problem = %d %q %q, want %d %q %q", p.Status, p.Code, p.Detail, tt.wantStatus, tt.wantCode, tt.wantDetail)
+			}
+			if len(p.Errors) != tt.wantFields {
+				t.Errorf("field errors = %d, want %d", len(p.Errors), tt.wantFields)
+			}
+			if p.RequestID != "req-1" {
+				t.Errorf("request id = %q, want %q", p.RequestID, "req-1")
+			}
+			if p.Title != statusText(tt.wantStatus) || p.Type != "about:blank" || p.Instance != "/users/me" {
+				t.Errorf("problem = %+v, want standard members filled in", p)
+			}
+		})
+	}
+}
@@ -1,13 +1,13 @@
 package response
 
-const (
-	StatusOK  = "OK"
-	StatusErr = "Error"
-)
+import "user-management-service/internal/models"
 
+const StatusOK = "OK"
+
+// Response is the body of requests which succeeded with nothing else to tell,
+// errors are told as problems
 type Response struct {
 	Status string `json:"status"`
-	Error  string `json:"error,omitempty"`
 }
 
 type Tokens struct {
@@ -15,15 +15,97 @@ type Tokens struct {
 	RefreshToken string `json:"refreshToken,omitempty"`
 }
 
-func Ok() Response {
-	return Response{
-		Status: StatusOK,
-	}
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
 }
 
-func Err(errMsg string) Response {
+type GroupList struct {
+	Groups     []models.Group `json:"groups"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+type Sessions struct {
+	Sessions []models.Session `json:"sessions"`
+}
+
+type PersonalTokens struct {
+	Tokens []models.PersonalAccessToken `json:"tokens"`
+}
+
+// PersonalTokenCreated carries a new personal access token, which is never shown again
+type PersonalTokenCreated struct {
+	Token *models.PersonalAccessToken `json:"token"`
+	Value string                      `json:"value"`
+}
+
+type ServiceAccounts struct {
+	ServiceAccounts []models.ServiceAccount `json:"serviceAccounts"`
+}
+
+// ServiceAccountCreated carries the secret of a service account, which is never shown again
+type ServiceAccountCreated struct {
+	ServiceAccount *models.ServiceAccount `json:"serviceAccount,omitempty"`
+	ClientSecret   string                 `json:"clientSecret,omitempty"`
+}
+
+type OAuthClients struct {
+	Clients []models.OAuthClient `json:"clients"`
+}
+
+// OAuthClientCreated carries the secret of a confidential client, which is never shown again
+type OAuthClientCreated struct {
+	Client       *models.OAuthClient `json:"client"`
+	ClientSecret string              `json:"clientSecret,omitempty"`
+}
+
+type Authorization struct {
+	RedirectURI     string              `json:"redirectUri,omitempty"`
+	ConsentRequired bool                `json:"consentRequired,omitempty"`
+	Client          *models.OAuthClient `json:"client,omitempty"`
+	Scopes          []string            `json:"scopes,omitempty"`
+}
+
+// OAuthToken is the token response of RFC 6749 5.1
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// OAuthIntrospection is the introspection response of RFC 7662 2.2
+type OAuthIntrospection struct {
+	Active        bool   `json:"active"`
+	TokenType     string `json:"token_type,omitempty"`
+	PrincipalType string `json:"principal_type,omitempty"`
+	Sub           string `json:"sub,omitempty"`
+	ClientID      string `json:"client_id,omitempty"`
+	Role          string `json:"role,omitempty"`
+	Scope         string `json:"scope,omitempty"`
+	Exp           int64  `json:"exp,omitempty"`
+	Iat           int64  `json:"iat,omitempty"`
+}
+
+// OAuthError is the error response of RFC 6749 5.2
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func Ok() Response {
 	return Response{
-		Status: StatusErr,
-		Error:  errMsg,
+		Status: StatusOK,
 	}
 }
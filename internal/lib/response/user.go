@@ -0,0 +1,104 @@
+package response
+
+import (
+	"time"
+
+	"user-management-service/internal/models"
+)
+
+// Users are rendered in one of three representations, each a superset of the
+// previous one. Fields are copied one by one from models.User, so a field added
+// to the model stays out of responses until it is added here on purpose.
+
+// PublicUser is what anyone allowed to see a user is told about them
+type PublicUser struct {
+	UUID        string `json:"uuid"`
+	Username    string `json:"username"`
+	Name        string `json:"name,omitempty"`
+	Surname     string `json:"surname,omitempty"`
+	ImageS3Path string `json:"image_s3_path,omitempty"`
+}
+
+// SelfUser is what users are told about themselves
+type SelfUser struct {
+	PublicUser
+	Email           string     `json:"email"`
+	PhoneNumber     string     `json:"phone_number,omitempty"`
+	Role            string     `json:"role"`
+	Groups          []string   `json:"groups,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	ModifiedAt      *time.Time `json:"modified_at,omitempty"`
+}
+
+// AdminUser is what moderators and administrators are told about a user
+type AdminUser struct {
+	SelfUser
+	IsBlocked    bool       `json:"is_blocked"`
+	BlockReason  string     `json:"block_reason,omitempty"`
+	BlockedAt    *time.Time `json:"blocked_at,omitempty"`
+	BlockedUntil *time.Time `json:"blocked_until,omitempty"`
+	BlockedBy    string     `json:"blocked_by,omitempty"`
+}
+
+func NewPublicUser(u *models.User) PublicUser {
+	return PublicUser{
+		UUID:        u.UUID,
+		Username:    u.Username,
+		Name:        u.Name,
+		Surname:     u.Surname,
+		ImageS3Path: u.ImageS3Path,
+	}
+}
+
+func NewSelfUser(u *models.User) SelfUser {
+	return SelfUser{
+		PublicUser:      NewPublicUser(u),
+		Email:           u.Email,
+		PhoneNumber:     u.PhoneNumber,
+		Role:            u.Role,
+		Groups:          u.Groups,
+		EmailVerifiedAt: u.EmailVerifiedAt,
+		CreatedAt:       u.CreatedAt,
+		ModifiedAt:      u.ModifiedAt,
+	}
+}
+
+func NewAdminUser(u *models.User) AdminUser {
+	return AdminUser{
+		SelfUser:     NewSelfUser(u),
+		IsBlocked:    u.IsBlocked,
+		BlockReason:  u.BlockReason,
+		BlockedAt:    u.BlockedAt,
+		BlockedUntil: u.BlockedUntil,
+		BlockedBy:    u.BlockedBy,
+	}
+}
+
+func NewPublicUsers(users []models.User) []PublicUser {
+	list := make([]PublicUser, len(users))
+	for i := range users {
+		list[i] = NewPublicUser(&users[i])
+	}
+
+	return list
+}
+
+func NewAdminUsers(users []models.User) []AdminUser {
+	list := make([]AdminUser, len(users))
+	for i := range users {
+		list[i] = NewAdminUser(&users[i])
+	}
+
+	return list
+}
+
+type UserList struct {
+	Users      []AdminUser `json:"users"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+type MemberList struct {
+	Users      []PublicUser `json:"users"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
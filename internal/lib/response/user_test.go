@@ -0,0 +1,73 @@
+package response
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"user-management-service/internal/models"
+)
+
+const hash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+
+func testUser() *models.User {
+	now := time.Now()
+	return &models.User{
+		UUID:         "5f0c1b8e-7c1a-4a5e-9a47-3f1f0f6d2c11",
+		Username:     "john",
+		Name:         "John",
+		Email:        "john@example.com",
+		PhoneNumber:  "+14155552671",
+		Role:         models.RoleUser,
+		Groups:       []string{"staff"},
+		PassHash:     models.PassHash(hash),
+		IsBlocked:    true,
+		BlockReason:  "spam",
+		BlockedAt:    &now,
+		BlockedUntil: &now,
+		BlockedBy:    "moderator",
+		CreatedAt:    &now,
+	}
+}
+
+func TestUserRepresentations(t *testing.T) {
+	tests := []struct {
+		name     string
+		v        any
+		wantKeys []string
+	}{
+		{name: "public", v: NewPublicUser(testUser()), wantKeys: []string{"uuid", "username", "name"}},
+		{name: "self", v: NewSelfUser(testUser()), wantKeys: []string{"uuid", "username", "name", "email", "phone_number", "role", "groups", "created_at"}},
+		{name: "admin", v: NewAdminUser(testUser()), wantKeys: []string{"uuid", "username", "name", "email", "phone_number", "role", "groups", "created_at", "is_blocked", "block_reason", "blocked_at", "blocked_until", "blocked_by"}},
+		{name: "user list", v: UserList{Users: NewAdminUsers([]models.User{*testUser()})}, wantKeys: []string{"users"}},
+		{name: "member list", v: MemberList{Users: NewPublicUsers([]models.User{*testUser()})}, wantKeys: []string{"users"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.v)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			if strings.Contains(string(b), hash) || strings.Contains(string(b), "pass") {
+				t.Errorf("response leaks the password hash: %s", b)
+			}
+
+			var got map[string]json.RawMessage
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			var keys []string
+			for k := range got {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+			slices.Sort(tt.wantKeys)
+			if !slices.Equal(keys, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the size of the keys of Seal, which uses AES-256
+const KeySize = 32
+
+var ErrCannotOpen = errors.New("cannot open sealed data")
+
+// New returns a random URL-safe string carrying size bytes of entropy
+func New(size int) (string, error) {
+	const op = "New"
+
+	b, err := Bytes(size)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Bytes returns size random bytes
+func Bytes(size int) ([]byte, error) {
+	const op = "Bytes"
+
+	b := make([]byte, size)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return b, nil
+}
+
+// Hash returns the digest under which a high-entropy secret is stored.
+// Secrets from New don't need a slow hash, unlike passwords.
+func Hash(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
+
+// Seal encrypts and authenticates plaintext with AES-256-GCM under key, binding it
+// to data, which has to be given to Open again. The random nonce comes first.
+func Seal(key, plaintext, data []byte) ([]byte, error) {
+	const op = "Seal"
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	nonce, err := Bytes(aead.NonceSize())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, data), nil
+}
+
+// Open decrypts what Seal sealed under key with data, failing with ErrCannotOpen
+// for another key or data, or if the sealed bytes were tampered with
+func Open(key, sealed, data []byte) ([]byte, error) {
+	const op = "Open"
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s: %w", op, ErrCannotOpen)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrCannotOpen)
+	}
+
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key is %d bytes, want %d", len(key), KeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,71 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for SHA1, truncated to 6 digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name string
+		time int64
+		want string
+	}{
+		{name: "59", time: 59, want: "287082"},
+		{name: "1111111109", time: 1111111109, want: "081804"},
+		{name: "1111111111", time: 1111111111, want: "050471"},
+		{name: "1234567890", time: 1234567890, want: "005924"},
+		{name: "2000000000", time: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Code(secret, time.Unix(tt.time, 0))
+			if err != nil {
+				t.Fatalf("Code() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Code() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		code   string
+		at     time.Time
+		wantOk bool
+	}{
+		{name: "current period", code: code, at: now, wantOk: true},
+		{name: "previous period", code: code, at: now.Add(Period), wantOk: true},
+		{name: "too old", code: code, at: now.Add(3 * Period), wantOk: false},
+		{name: "wrong length", code: code[:5], at: now, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.code, secret, tt.at)
+			if ok != tt.wantOk {
+				t.Fatalf("Validate() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && step != Step(now) {
+				t.Errorf("Validate() step = %v, want %v", step, Step(now))
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type Group struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+}
+
+// GroupPatch holds the group fields to change, nil fields are left untouched
+type GroupPatch struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Failed logins are counted per account and per client address. The subjects
+// tell the counters apart, as usernames and addresses could look alike.
+
+// AccountLoginSubject is the subject failed logins as username are counted under
+func AccountLoginSubject(username string) string {
+	return "user:" + username
+}
+
+// IPLoginSubject is the subject failed logins from ip are counted under
+func IPLoginSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginAttempt is a login attempt, counted as failed until it is known to be right
+type LoginAttempt struct {
+	// ID tells the attempt apart from the other failed logins of the account
+	ID string
+	// Failures is the number of failed logins of the account within the window, the attempt included
+	Failures int
+	// LockedFor is how long the account stays locked, if the attempt was rejected for that
+	LockedFor time.Duration
+	// RetryAfter is how long to wait after the last failed login, if the attempt came too early
+	RetryAfter time.Duration
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// OAuth grant types a client may be registered for
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// OAuthClient is an application registered to obtain tokens through OAuth.
+// Public clients, such as mobile apps, can't keep a secret and have none.
+type OAuthClient struct {
+	ID           string    `json:"client_id"`
+	Name         string    `json:"name"`
+	SecretHash   []byte    `json:"-"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AuthorizationCode is what a user authorized a client to do, until the client exchanges it for tokens
+type AuthorizationCode struct {
+	ClientID      string
+	UserUUID      string
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	// Nonce is passed on to the ID token for the client to match it with its request
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+// Consent is the scopes a user allowed a client
+type Consent struct {
+	UserUUID  string    `json:"-"`
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"granted_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// PersonalAccessTokenPrefix starts every personal access token, telling it from a JWT
+const PersonalAccessTokenPrefix = "pat_"
+
+// PersonalAccessToken is a long-lived credential of a user for scripts and tools.
+// Only its hash is stored, Prefix is the part shown to recognize it by.
+type PersonalAccessToken struct {
+	ID         string     `json:"id"`
+	UserUUID   string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Expired reports whether the token is expired at the time at. Tokens without an expiry last until deleted
+func (t *PersonalAccessToken) Expired(at time.Time) bool {
+	return t.ExpiresAt != nil && !at.Before(*t.ExpiresAt)
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	// EventRefreshTokenReuse is raised when a rotated refresh token is presented again
+	EventRefreshTokenReuse = "refresh_token_reuse"
+	// EventAccountLocked is raised when too many failed logins lock the account
+	EventAccountLocked = "account_locked"
+)
+
+// SecurityEvent is published for consumers alerting users and administrators
+type SecurityEvent struct {
+	Type       string    `json:"type"`
+	UserUUID   string    `json:"user_uuid"`
+	SessionID  string    `json:"session_id,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
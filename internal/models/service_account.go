@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Principal types, written into the "principal_type" claim of access tokens
+// so that their consumers can tell humans from machines
+const (
+	PrincipalUser           = "user"
+	PrincipalServiceAccount = "service_account"
+	PrincipalClient         = "client"
+)
+
+// ServiceAccountIDPrefix starts the id of every service account, telling it from an OAuth client id
+const ServiceAccountIDPrefix = "sa_"
+
+// ServiceAccount is a machine principal. It has no password nor email and gets its
+// tokens with a client secret or with a JWT assertion signed by its PublicKey.
+// It is owned by a group, or else by the admin who created it.
+type ServiceAccount struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Role         string    `json:"role"`
+	OwnerGroupID string    `json:"owner_group_id,omitempty"`
+	CreatedBy    string    `json:"created_by,omitempty"`
+	SecretHash   []byte    `json:"-"`
+	PublicKey    string    `json:"public_key,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Session is a device the user logged in from, kept alive by refreshing its tokens
+type Session struct {
+	ID         string     `json:"id"`
+	UserUUID   string     `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	RefreshJTI string     `json:"-"`
+	Current    bool       `json:"current"`
+}
+
+// Client describes where a request comes from
+type Client struct {
+	UserAgent string
+	IP        string
+}
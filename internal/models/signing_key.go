@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	// PrivateKey is the PKCS #8 DER of the key, sealed unless it was stored
+	// before keys were encrypted
+	PrivateKey []byte
+	Encrypted  bool
+	CreatedAt  time.Time
+	RetiredAt  *time.Time
+	ExpiresAt  *time.Time
+}
@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+type TOTP struct {
+	Secret       string     `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	LastUsedStep int64      `json:"-"`
+}
@@ -1,20 +1,90 @@
 package models
 
-import "time"
+import (
+	"log/slog"
+	"time"
+)
 
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// User is the domain model of a user. It is never rendered as is, see the
+// representations in lib/response.
 type User struct {
-	UUID        string     `json:"uuid,omitempty"`
-	Name        string     `json:"name,omitempty"`
-	Surname     string     `json:"surname,omitempty"`
-	Password    string     `json:"password,omitempty"`
-	Username    string     `json:"username,omitempty"`
-	PassHash    []byte     `json:"pass_hash,omitempty"`
-	PhoneNumber string     `json:"phone_number,omitempty"`
-	Email       string     `json:"email,omitempty"`
-	Role        string     `json:"role,omitempty"`
-	Groups      []string   `json:"groups ,omitempty"`
-	ImageS3Path string     `json:"image_s3_path,omitempty"`
-	IsBlocked   bool       `json:"is_blocked,omitempty"`
-	CreatedAt   *time.Time `json:"created_at,omitempty"`
-	ModifiedAt  *time.Time `json:"modified_at,omitempty"`
+	UUID            string     `json:"uuid,omitempty"`
+	Name            string     `json:"name,omitempty"`
+	Surname         string     `json:"surname,omitempty"`
+	Username        string     `json:"username,omitempty"`
+	PassHash        PassHash   `json:"-"`
+	PhoneNumber     string     `json:"phone_number,omitempty"`
+	Email           string     `json:"email,omitempty"`
+	Role            string     `json:"role,omitempty"`
+	Groups          []string   `json:"groups,omitempty"`
+	ImageS3Path     string     `json:"image_s3_path,omitempty"`
+	IsBlocked       bool       `json:"is_blocked,omitempty"`
+	BlockReason     string     `json:"block_reason,omitempty"`
+	BlockedAt       *time.Time `json:"blocked_at,omitempty"`
+	BlockedUntil    *time.Time `json:"blocked_until,omitempty"`
+	BlockedBy       string     `json:"blocked_by,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	ModifiedAt      *time.Time `json:"modified_at,omitempty"`
+}
+
+// PassHash is a bcrypt password hash. It prints, logs and marshals redacted,
+// so a user can't leak it by being logged or rendered by accident.
+type PassHash []byte
+
+const redacted = "[REDACTED]"
+
+func (PassHash) String() string {
+	return redacted
+}
+
+func (PassHash) GoString() string {
+	return redacted
+}
+
+func (PassHash) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (PassHash) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+func (PassHash) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// Blocked reports whether the user is blocked at t. Temporary blocks end by themselves
+func (u *User) Blocked(t time.Time) bool {
+	return u.IsBlocked && (u.BlockedUntil == nil || t.Before(*u.BlockedUntil))
+}
+
+// UserFilter selects, orders and paginates users for the admin API
+type UserFilter struct {
+	Role          string
+	Blocked       *bool
+	Email         string
+	Username      string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          string
+	Order         string
+	Limit         int
+	Cursor        string
+}
+
+// UserPatch holds the fields an administrator changes, nil fields are left untouched
+type UserPatch struct {
+	Name        *string `json:"name,omitempty"`
+	Surname     *string `json:"surname,omitempty"`
+	Username    *string `json:"username,omitempty"`
+	PhoneNumber *string `json:"phone_number,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	Role        *string `json:"role,omitempty"`
 }
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestPassHashRedacted(t *testing.T) {
+	const hash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+	user := &User{UUID: "5f0c1b8e", Username: "john", PassHash: PassHash(hash)}
+
+	logged := func(h func(*bytes.Buffer) slog.Handler, args ...any) string {
+		var buf bytes.Buffer
+		slog.New(h(&buf)).Info("user's info from db", args...)
+		return buf.String()
+	}
+	text := func(buf *bytes.Buffer) slog.Handler { return slog.NewTextHandler(buf, nil) }
+	jsonHandler := func(buf *bytes.Buffer) slog.Handler { return slog.NewJSONHandler(buf, nil) }
+	marshaled := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		name string
+		out  string
+	}{
+		{name: "%v", out: fmt.Sprintf("%v", user)},
+		{name: "%+v", out: fmt.Sprintf("%+v", *user)},
+		{name: "%#v", out: fmt.Sprintf("%#v", *user)},
+		{name: "%s", out: fmt.Sprintf("%s", user.PassHash)},
+		{name: "%x", out: fmt.Sprintf("%x", user.PassHash)},
+		{name: "slice", out: fmt.Sprintf("%+v", []User{*user})},
+		{name: "json", out: marshaled(user)},
+		{name: "text log", out: logged(text, slog.Any("user", user))},
+		{name: "json log", out: logged(jsonHandler, slog.Any("user", user))},
+		{name: "text log of a value", out: logged(text, slog.Any("user", *user))},
+		{name: "json log of a slice", out: logged(jsonHandler, slog.Any("users", []User{*user}))},
+		{name: "logged hash", out: logged(jsonHandler, slog.Any("hash", user.PassHash))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.Contains(tt.out, hash) || strings.Contains(tt.out, fmt.Sprintf("%x", []byte(hash))) {
+				t.Errorf("password hash leaked: %s", tt.out)
+			}
+		})
+	}
+}
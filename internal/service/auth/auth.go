@@ -5,61 +5,131 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"user-management-service/internal/config"
 	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/secret"
 	"user-management-service/internal/models"
 	"user-management-service/internal/storage"
 
-	gojwt "github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrUserNotFound  = errors.New("user not found")
-	ErrUserExists    = errors.New("user already exists")
-	ErrTokenRevoked  = errors.New("token revoked")
-	ErrEmailNotFound = errors.New("email not found")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrUserExists           = errors.New("user already exists")
+	ErrTokenRevoked         = errors.New("token revoked")
+	ErrTokenReused          = errors.New("refresh token reused")
+	ErrEmailNotVerified     = errors.New("email not verified")
+	ErrUserBlocked          = errors.New("user is blocked")
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	ErrInvalidToken         = errors.New("invalid token")
+	ErrMFARequired          = errors.New("mfa required")
+	ErrInvalidMFACode       = errors.New("invalid mfa code")
+	ErrMFAAlreadyEnabled    = errors.New("mfa already enabled")
+	ErrMFANotEnabled        = errors.New("mfa not enabled")
+	ErrSessionNotFound      = errors.New("session not found")
+)
+
+const (
+	// resetTokenSize is the number of random bytes in a password reset token
+	resetTokenSize = 32
+	// jtiSize is the number of random bytes in a token id
+	jtiSize = 16
 )
 
 type Storage interface {
 	UserByName(ctx context.Context, username string) (*models.User, error)
 	UserByUUID(ctx context.Context, uuid string) (*models.User, error)
-	SearchEmail(ctx context.Context, email string) (bool, error)
-	CreateNewUser(ctx context.Context, username, email string, passHash []byte) error
+	UserByEmail(ctx context.Context, email string) (*models.User, error)
+	CreateSession(ctx context.Context, uuid, jti string, client models.Client, expiresAt time.Time) (string, error)
+	RotateSession(ctx context.Context, uuid, id, oldJTI, newJTI string, client models.Client, expiresAt time.Time) error
+	Sessions(ctx context.Context, uuid string) ([]models.Session, error)
+	RevokeSession(ctx context.Context, uuid, id string) error
+	RevokeSessions(ctx context.Context, uuid string) ([]models.Session, error)
+	GroupNames(ctx context.Context, uuid string) ([]string, error)
+	CreateNewUser(ctx context.Context, username, email string, passHash []byte) (string, error)
+	VerifyEmail(ctx context.Context, uuid, email string) error
+	CreatePasswordResetToken(ctx context.Context, uuid string, tokenHash []byte, expiresAt time.Time) error
+	ResetPassword(ctx context.Context, tokenHash []byte, passHash []byte) (string, error)
+	TOTP(ctx context.Context, uuid string) (*models.TOTP, error)
+	SaveTOTPSecret(ctx context.Context, uuid string, secret string) error
+	ConfirmTOTP(ctx context.Context, uuid string, step int64, codeHashes [][]byte) error
+	UseTOTPStep(ctx context.Context, uuid string, step int64) error
+	DeleteTOTP(ctx context.Context, uuid string) error
+	UseRecoveryCode(ctx context.Context, uuid string, codeHash []byte) error
+	ReplaceRecoveryCodes(ctx context.Context, uuid string, codeHashes [][]byte) error
+	CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken, tokenHash []byte) error
+	PersonalAccessTokens(ctx context.Context, uuid string) ([]models.PersonalAccessToken, error)
+	PersonalAccessToken(ctx context.Context, tokenHash []byte) (*models.PersonalAccessToken, error)
+	TouchPersonalAccessToken(ctx context.Context, id string) error
+	DeletePersonalAccessToken(ctx context.Context, uuid, id string) error
 }
 
 type Cash interface {
-	AddToBlaclist(ctx context.Context, token string) error
-	SearchInBlacklist(ctx context.Context, token string) (bool, error)
+	RevokeToken(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	RevokeTokens(ctx context.Context, tokens map[string]time.Duration) error
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+	RevokeSessionTokens(ctx context.Context, sid string, ttl time.Duration) error
+	RevokeUserTokens(ctx context.Context, uuid string, ttl time.Duration) error
+	UserTokensRevokedAt(ctx context.Context, uuid string) (time.Time, error)
+	LoginFailures(ctx context.Context, subject string, window time.Duration) ([]time.Time, error)
+	AddLoginFailure(ctx context.Context, subject string, window time.Duration) (int, error)
+	ResetLoginFailures(ctx context.Context, subject string) error
+	LockAccount(ctx context.Context, username string, ttl time.Duration) error
+	ReserveLoginAttempt(ctx context.Context, username string, window time.Duration, delays []time.Duration) (models.LoginAttempt, error)
+	ReleaseLoginAttempt(ctx context.Context, username, id string) error
 }
 
 type Broker interface {
-	ResetPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, email, token string) error
+	VerifyEmail(ctx context.Context, email, token string) error
+	SecurityEvent(ctx context.Context, event models.SecurityEvent) error
 }
 
 type Service struct {
-	log      *slog.Logger
-	storage  Storage
-	cash     Cash
-	broker   Broker
-	tokenCfg config.Token
+	log       *slog.Logger
+	storage   Storage
+	cash      Cash
+	broker    Broker
+	keys      *jwt.KeySet
+	tokenCfg  config.Token
+	authCfg   config.Auth
+	deadlines config.Deadlines
 }
 
-func New(log *slog.Logger, storage Storage, cash Cash, broker Broker, token config.Token) *Service {
+func New(log *slog.Logger, storage Storage, cash Cash, broker Broker, keys *jwt.KeySet, token config.Token, auth config.Auth, deadlines config.Deadlines) *Service {
 	return &Service{
-		log:      log,
-		storage:  storage,
-		cash:     cash,
-		broker:   broker,
-		tokenCfg: token,
+		log:       log,
+		storage:   storage,
+		cash:      cash,
+		broker:    broker,
+		keys:      keys,
+		tokenCfg:  token,
+		authCfg:   auth,
+		deadlines: deadlines,
 	}
 }
 
-func (s *Service) SignUp(username, email, password string) error {
+// withDeadline bounds ctx by the deadline of the operation op
+func (s *Service) withDeadline(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.deadlines.For(op))
+}
+
+// detached keeps the values of ctx but not its cancellation, for work that must be
+// done once started even if the client goes away, bounded by the deadline of op
+func (s *Service) detached(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), s.deadlines.For(op))
+}
+
+func (s *Service) SignUp(ctx context.Context, username, email, password string) error {
 	const op = "service.auth.SignUp"
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := s.withDeadline(ctx, op)
 	defer cancel()
 
 	u, err := s.storage.UserByName(ctx, username)
@@ -67,7 +137,7 @@ func (s *Service) SignUp(username, email, password string) error {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 	if u != nil {
-		return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		return fmt.Errorf("%s: %w", op, ErrUserExists)
 	}
 
 	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -75,46 +145,99 @@ func (s *Service) SignUp(username, email, password string) error {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = s.storage.CreateNewUser(ctx, username, email, passHash)
+	uuid, err := s.storage.CreateNewUser(ctx, username, email, passHash)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	// The user is already created at this point and can ask for another email,
+	// so failing to send this one must not fail the signup
+	err = s.sendVerification(ctx, &models.User{UUID: uuid, Email: email})
+	if err != nil {
+		logger.FromContext(ctx, s.log).Error("failed to send verification email", slog.String("op", op), slog.String("uuid", uuid), sl.Error(err))
+	}
+
 	return nil
 }
 
-func (s *Service) Login(username, password string) (string, string, error) {
+func (s *Service) Login(ctx context.Context, username, password string, client models.Client) (string, string, error) {
 	const op = "service.auth.Login"
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := s.withDeadline(ctx, op)
 	defer cancel()
 
-	s.log.Debug("", slog.String("username", username))
+	logger.FromContext(ctx, s.log).Debug("", slog.String("username", username))
+
+	// Throttled attempts don't get as far as the password
+	attempt, err := s.reserveLogin(ctx, username, client)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
 
 	// Search for username
 	user, err := s.storage.UserByName(ctx, username)
 	if err != nil {
-		if errors.As(err, &storage.ErrUserNotFound) {
-			return "", "", fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			s.loginFailed(ctx, username, attempt, nil, client)
+			return "", "", fmt.Errorf("%s: %w", op, ErrUserNotFound)
 		}
+		s.releaseLogin(ctx, username, attempt)
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	s.log.Debug("user's info from db", slog.Any("user", user))
+	logger.FromContext(ctx, s.log).Debug("user's info from db", slog.Any("user", user))
 
 	// If username found, compsre password hash
 	err = bcrypt.CompareHashAndPassword(user.PassHash, []byte(password))
 	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			s.loginFailed(ctx, username, attempt, user, client)
+			return "", "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		}
+		s.releaseLogin(ctx, username, attempt)
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Generate access & refresh tokens
-	accessToken, err := jwt.NewAccessToken(user, s.tokenCfg)
+	// The password is right, whatever happens next is no failed login
+	s.releaseLogin(ctx, username, attempt)
+
+	// Checked only once the password is known to be right, not to tell who is blocked
+	if user.Blocked(time.Now()) {
+		return "", "", fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	if s.authCfg.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return "", "", fmt.Errorf("%s: %w", op, ErrEmailNotVerified)
+	}
+
+	// With TOTP enrolled the password alone is not enough
+	mfaEnabled, err := s.mfaEnabled(ctx, user.UUID)
 	if err != nil {
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
+	if mfaEnabled {
+		challenge, err := jwt.NewMFAChallengeToken(user, s.tokenCfg, s.keys)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+		return "", "", &MFARequiredError{Token: challenge}
+	}
 
-	refreshToken, err := jwt.NewRefreshToken(user, s.tokenCfg)
+	// Failed logins are only forgotten once both factors passed, or every right
+	// password would clear the way for guessing more codes
+	s.loginSucceeded(ctx, username)
+
+	user.Role = s.effectiveRole(user.Role, false)
+
+	if s.tokenCfg.JWT.GroupsClaim {
+		user.Groups, err = s.storage.GroupNames(ctx, user.UUID)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// Generate access & refresh tokens
+	accessToken, refreshToken, err := s.startSession(ctx, user, client, jwt.Grant{})
 	if err != nil {
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -122,81 +245,242 @@ func (s *Service) Login(username, password string) (string, string, error) {
 	return accessToken, refreshToken, nil
 }
 
-func (s *Service) RefreshToken(token string) (string, string, error) {
+func (s *Service) RefreshToken(ctx context.Context, token string, client models.Client) (string, string, error) {
 	const op = "service.auth.RefreshToken"
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := s.withDeadline(ctx, op)
 	defer cancel()
 
-	// Search token in blacklist
-	found, err := s.cash.SearchInBlacklist(ctx, token)
+	accessToken, refreshToken, err := s.refresh(ctx, token, "", client)
 	if err != nil {
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
-	if found {
-		return "", "", fmt.Errorf("%s: %w", op, ErrTokenRevoked)
-	}
 
-	// Add old token to blacklist
-	err = s.cash.AddToBlaclist(ctx, token)
-	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
-	}
+	return accessToken, refreshToken, nil
+}
 
+// refresh rotates the refresh token of the OAuth client clientID, which is empty
+// for the tokens of the service's own login, and issues a new token pair
+func (s *Service) refresh(ctx context.Context, token, clientID string, client models.Client) (string, string, error) {
 	// Parse refresh token to get it's claims
-	jwtToken, err := gojwt.Parse(token, func(t *gojwt.Token) (interface{}, error) {
-		return []byte(s.tokenCfg.JWT.Secret), nil
-	})
+	claims, err := jwt.Parse(token, s.keys, jwt.TypeRefresh)
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidToken, err)
 	}
-	claims := jwtToken.Claims.(gojwt.MapClaims)
 
 	// Get UUID from token's claims
 	uuid, err := jwt.GetClaim(claims, "sub")
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	// A token of one client can't be refreshed by another
+	grant := jwt.GrantFromClaims(claims)
+	if grant.ClientID != clientID {
+		return "", "", ErrInvalidToken
+	}
+
+	id := jwt.ID(claims, token)
+	revoked, err := s.cash.IsTokenRevoked(ctx, id)
+	if err != nil {
+		return "", "", err
+	}
+	if revoked {
+		return "", "", ErrTokenRevoked
+	}
+
+	// Tokens issued before token families can't be told apart, each may be used once
+	family := jwt.FamilyID(claims)
+	if family == "" {
+		ok, err := s.cash.RevokeToken(ctx, id, jwt.Remaining(claims))
+		if err != nil {
+			return "", "", err
+		}
+		if !ok {
+			return "", "", ErrTokenRevoked
+		}
+	}
+
+	// Reject tokens issued before all user's tokens were revoked, e.g. by a password reset
+	revokedAt, err := s.cash.UserTokensRevokedAt(ctx, uuid)
+	if err != nil {
+		return "", "", err
+	}
+	if !revokedAt.IsZero() && jwt.IssuedBefore(claims, revokedAt) {
+		return "", "", ErrTokenRevoked
 	}
 
 	// Get user info to form tokens
 	user, err := s.storage.UserByUUID(ctx, uuid)
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		// The tokens of a deleted user are as good as revoked
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", "", fmt.Errorf("%w: %w", ErrTokenRevoked, err)
+		}
+		return "", "", err
+	}
+	if user.Blocked(time.Now()) {
+		return "", "", ErrUserBlocked
 	}
 
-	// Form new access token
-	accessToken, err := jwt.NewAccessToken(user, s.tokenCfg)
+	mfaEnabled, err := s.mfaEnabled(ctx, uuid)
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return "", "", err
+	}
+	user.Role = s.effectiveRole(user.Role, mfaEnabled)
+
+	if family == "" {
+		return s.startSession(ctx, user, client, grant)
 	}
 
-	// Form new refresh token
-	refreshToken, err := jwt.NewRefreshToken(user, s.tokenCfg)
+	jti, _ := claims["jti"].(string)
+	newJTI, err := secret.New(jtiSize)
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return "", "", err
 	}
 
-	return accessToken, refreshToken, nil
+	err = s.storage.RotateSession(ctx, uuid, family, jti, newJTI, client, time.Now().Add(s.tokenCfg.Refresh.TTL))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenReused) {
+			s.reportTokenReuse(ctx, uuid, family, client)
+			return "", "", ErrTokenReused
+		}
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return "", "", ErrTokenRevoked
+		}
+		return "", "", err
+	}
+
+	return s.issueTokens(user, family, newJTI, grant)
 }
 
-func (s *Service) ResetPassword(email string) error {
+func (s *Service) ResetPassword(ctx context.Context, email string) error {
 	const op = "service.auth.ResetPassword"
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := s.withDeadline(ctx, op)
 	defer cancel()
 
-	found, err := s.storage.SearchEmail(ctx, email)
+	// Unknown emails are answered like the others, not to tell which are registered
+	user, err := s.storage.UserByEmail(ctx, email)
 	if err != nil {
+		if errors.Is(err, storage.ErrEmailNotFound) {
+			return nil
+		}
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	if !found {
-		return fmt.Errorf("%s: %w", op, storage.ErrEmailNotFound)
+
+	// Only the hash is stored, the token itself goes to the user's mailbox
+	token, err := secret.New(resetTokenSize)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = s.broker.ResetPassword(ctx, email)
+	err = s.storage.CreatePasswordResetToken(ctx, user.UUID, secret.Hash(token), time.Now().Add(s.tokenCfg.Reset.TTL))
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	err = s.broker.ResetPassword(ctx, user.Email, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Service) ConfirmResetPassword(ctx context.Context, token, password string) error {
+	const op = "service.auth.ConfirmResetPassword"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	uuid, err := s.storage.ResetPassword(ctx, secret.Hash(token), passHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Whoever knew the old password must not keep the sessions opened with it
+	err = jwt.EndSessions(ctx, s.storage, s.cash, uuid, s.tokenCfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	const op = "service.auth.VerifyEmail"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	claims, err := jwt.Parse(token, s.keys, jwt.TypeEmailVerification)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	uuid, err := jwt.GetClaim(claims, "sub")
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	email, err := jwt.GetClaim(claims, "email")
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	// The update only matches an unverified address equal to the one in the token,
+	// which makes every token single-use
+	err = s.storage.VerifyEmail(ctx, uuid, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrEmailAlreadyVerified) {
+			return fmt.Errorf("%s: %w", op, ErrEmailAlreadyVerified)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	return nil
 }
+
+func (s *Service) ResendVerification(ctx context.Context, email string) error {
+	const op = "service.auth.ResendVerification"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	// Unknown and verified emails are answered like the others, not to tell which are registered
+	user, err := s.storage.UserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrEmailNotFound) {
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	err = s.sendVerification(ctx, user)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Service) sendVerification(ctx context.Context, user *models.User) error {
+	token, err := jwt.NewEmailVerificationToken(user, s.tokenCfg, s.keys)
+	if err != nil {
+		return err
+	}
+
+	return s.broker.VerifyEmail(ctx, user.Email, token)
+}
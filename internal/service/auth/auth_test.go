@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+// memoryStorage keeps users and sessions in memory, mimicking storage.postgres.
+// Methods the tests don't need panic through the nil Storage.
+type memoryStorage struct {
+	Storage
+	users    map[string]*models.User
+	sessions map[string]*memorySession
+}
+
+type memorySession struct {
+	uuid    string
+	latest  *string
+	revoked bool
+}
+
+func newMemoryStorage(users ...*models.User) *memoryStorage {
+	m := &memoryStorage{users: map[string]*models.User{}, sessions: map[string]*memorySession{}}
+	for _, u := range users {
+		m.users[u.UUID] = u
+	}
+
+	return m
+}
+
+func (m *memoryStorage) UserByName(_ context.Context, username string) (*models.User, error) {
+	for _, u := range m.users {
+		if u.Username == username {
+			user := *u
+			return &user, nil
+		}
+	}
+
+	return nil, storage.ErrUserNotFound
+}
+
+func (m *memoryStorage) UserByUUID(_ context.Context, uuid string) (*models.User, error) {
+	u, ok := m.users[uuid]
+	if !ok {
+		return nil, storage.ErrUserNotFound
+	}
+	user := *u
+
+	return &user, nil
+}
+
+func (m *memoryStorage) TOTP(_ context.Context, _ string) (*models.TOTP, error) {
+	return nil, storage.ErrTOTPNotFound
+}
+
+func (m *memoryStorage) CreateSession(_ context.Context, uuid, jti string, _ models.Client, _ time.Time) (string, error) {
+	id := fmt.Sprintf("session-%d", len(m.sessions)+1)
+	m.sessions[id] = &memorySession{uuid: uuid, latest: &jti}
+
+	return id, nil
+}
+
+func (m *memoryStorage) RotateSession(_ context.Context, uuid, id, oldJTI, newJTI string, _ models.Client, _ time.Time) error {
+	ss, ok := m.sessions[id]
+	if !ok || ss.uuid != uuid || ss.revoked {
+		return storage.ErrSessionNotFound
+	}
+
+	if storage.RefreshTokenReused(ss.latest, oldJTI) {
+		ss.revoked = true
+		return storage.ErrTokenReused
+	}
+	ss.latest = &newJTI
+
+	return nil
+}
+
+// memoryCash is a denylist and login counter in memory, mimicking cache.redis.
+// Methods the tests don't need panic through the nil Cash.
+type memoryCash struct {
+	Cash
+	tokens   map[string]bool
+	sessions map[string]bool
+	failures map[string][]loginFailure
+	locks    map[string]time.Time
+}
+
+type loginFailure struct {
+	id string
+	at time.Time
+}
+
+func newMemoryCash() *memoryCash {
+	return &memoryCash{
+		tokens:   map[string]bool{},
+		sessions: map[string]bool{},
+		failures: map[string][]loginFailure{},
+		locks:    map[string]time.Time{},
+	}
+}
+
+func (c *memoryCash) RevokeToken(_ context.Context, id string, _ time.Duration) (bool, error) {
+	if c.tokens[id] {
+		return false, nil
+	}
+	c.tokens[id] = true
+
+	return true, nil
+}
+
+func (c *memoryCash) IsTokenRevoked(_ context.Context, id string) (bool, error) {
+	return c.tokens[id], nil
+}
+
+func (c *memoryCash) RevokeSessionTokens(_ context.Context, sid string, _ time.Duration) error {
+	c.sessions[sid] = true
+	return nil
+}
+
+func (c *memoryCash) UserTokensRevokedAt(_ context.Context, _ string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (c *memoryCash) LoginFailures(_ context.Context, subject string, window time.Duration) ([]time.Time, error) {
+	var res []time.Time
+	for _, f := range c.failures[subject] {
+		if f.at.After(time.Now().Add(-window)) {
+			res = append(res, f.at)
+		}
+	}
+
+	return res, nil
+}
+
+func (c *memoryCash) AddLoginFailure(_ context.Context, subject string, window time.Duration) (int, error) {
+	c.failures[subject] = append(c.failures[subject], loginFailure{id: fmt.Sprint(time.Now().UnixNano()), at: time.Now()})
+	failures, _ := c.LoginFailures(context.Background(), subject, window)
+
+	return len(failures), nil
+}
+
+func (c *memoryCash) ResetLoginFailures(_ context.Context, subject string) error {
+	delete(c.failures, subject)
+	return nil
+}
+
+func (c *memoryCash) LockAccount(_ context.Context, username string, ttl time.Duration) error {
+	c.locks[username] = time.Now().Add(ttl)
+	return nil
+}
+
+func (c *memoryCash) ReserveLoginAttempt(ctx context.Context, username string, window time.Duration, delays []time.Duration) (models.LoginAttempt, error) {
+	if lockedFor := time.Until(c.locks[username]); lockedFor > 0 {
+		return models.LoginAttempt{LockedFor: lockedFor}, nil
+	}
+
+	subject := models.AccountLoginSubject(username)
+	failures, _ := c.LoginFailures(ctx, subject, window)
+	if n := len(failures); n > 0 && len(delays) > 0 {
+		if retryAfter := time.Until(failures[n-1].Add(delays[min(n, len(delays))-1])); retryAfter > 0 {
+			return models.LoginAttempt{RetryAfter: retryAfter}, nil
+		}
+	}
+
+	n, _ := c.AddLoginFailure(ctx, subject, window)
+	list := c.failures[subject]
+
+	return models.LoginAttempt{ID: list[len(list)-1].id, Failures: n}, nil
+}
+
+func (c *memoryCash) ReleaseLoginAttempt(_ context.Context, username, id string) error {
+	subject := models.AccountLoginSubject(username)
+	c.failures[subject] = slices.DeleteFunc(c.failures[subject], func(f loginFailure) bool { return f.id == id })
+
+	return nil
+}
+
+// memoryBroker collects the security events instead of publishing them
+type memoryBroker struct {
+	Broker
+	events []models.SecurityEvent
+}
+
+func (b *memoryBroker) SecurityEvent(_ context.Context, event models.SecurityEvent) error {
+	b.events = append(b.events, event)
+	return nil
+}
+
+// memoryKeyStorage keeps the signing keys in memory, rotating whenever asked
+type memoryKeyStorage struct {
+	keys []models.SigningKey
+}
+
+func (m *memoryKeyStorage) SigningKeys(_ context.Context) ([]models.SigningKey, error) {
+	return m.keys, nil
+}
+
+func (m *memoryKeyStorage) RotateSigningKey(_ context.Context, key models.SigningKey, _, _ time.Time) (bool, error) {
+	m.keys = append([]models.SigningKey{key}, m.keys...)
+	return true, nil
+}
+
+func newTestService(t *testing.T, storage *memoryStorage, cash *memoryCash, broker *memoryBroker) *Service {
+	t.Helper()
+
+	var cfg config.Token
+	cfg.JWT.TTL = time.Minute
+	cfg.JWT.Algorithm = jwt.AlgES256
+	cfg.JWT.RotationPeriod = time.Hour
+	cfg.JWT.KeyEncryptionKey = bytes.Repeat([]byte{0x5e}, secret.KeySize)
+	cfg.Refresh.TTL = time.Hour
+	cfg.MFA.TTL = time.Minute
+
+	keys, err := jwt.NewKeySet(context.Background(), &memoryKeyStorage{}, cfg)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return New(log, storage, cash, broker, keys, cfg, config.Auth{}, config.Deadlines{OperationTimeout: time.Second})
+}
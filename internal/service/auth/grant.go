@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+// StartGrant opens a session of the user for the OAuth client the user
+// authorized, and issues its first token pair under grant
+func (s *Service) StartGrant(ctx context.Context, uuid string, grant jwt.Grant, client models.Client) (string, string, error) {
+	const op = "service.auth.StartGrant"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	user, err := s.storage.UserByUUID(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", "", fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Blocked(time.Now()) {
+		return "", "", fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	mfaEnabled, err := s.mfaEnabled(ctx, uuid)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	user.Role = s.effectiveRole(user.Role, mfaEnabled)
+
+	accessToken, refreshToken, err := s.startSession(ctx, user, client, grant)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// RefreshGrant rotates a refresh token issued to the OAuth client clientID
+func (s *Service) RefreshGrant(ctx context.Context, token, clientID string, client models.Client) (string, string, error) {
+	const op = "service.auth.RefreshGrant"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	accessToken, refreshToken, err := s.refresh(ctx, token, clientID, client)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accessToken, refreshToken, nil
+}
@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/lib/totp"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+const (
+	recoveryCodesCount = 10
+	recoveryCodeSize   = 10
+)
+
+// MFARequiredError is returned by Login when the password is correct but the user
+// has TOTP enrolled. Token has to be passed to LoginMFA along with a code.
+type MFARequiredError struct {
+	Token string
+}
+
+func (e *MFARequiredError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+func (e *MFARequiredError) Unwrap() error {
+	return ErrMFARequired
+}
+
+// LoginMFA completes a login started by Login with a TOTP or a recovery code
+func (s *Service) LoginMFA(ctx context.Context, token, code string, client models.Client) (string, string, error) {
+	const op = "service.auth.LoginMFA"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	claims, err := jwt.Parse(token, s.keys, jwt.TypeMFAChallenge)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	uuid, err := jwt.GetClaim(claims, "sub")
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	user, err := s.storage.UserByUUID(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", "", fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Codes are throttled like passwords, against the same account
+	attempt, err := s.reserveLogin(ctx, user.Username, client)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// A challenge takes a single code, the next guess costs the password and a failed login
+	ok, err := s.cash.RevokeToken(ctx, jwt.ID(claims, token), jwt.Remaining(claims))
+	if err != nil {
+		s.releaseLogin(ctx, user.Username, attempt)
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	if !ok {
+		s.releaseLogin(ctx, user.Username, attempt)
+		return "", "", fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	err = s.verifySecondFactor(ctx, uuid, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.loginFailed(ctx, user.Username, attempt, user, client)
+		} else {
+			s.releaseLogin(ctx, user.Username, attempt)
+		}
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.loginSucceeded(ctx, user.Username)
+
+	if user.Blocked(time.Now()) {
+		return "", "", fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	accessToken, refreshToken, err := s.startSession(ctx, user, client, jwt.Grant{})
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// EnrollTOTP starts a TOTP enrollment and returns the shared secret
+// together with the otpauth:// URI to be shown to the user
+func (s *Service) EnrollTOTP(ctx context.Context, uuid string) (string, string, error) {
+	const op = "service.auth.EnrollTOTP"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	user, err := s.storage.UserByUUID(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", "", fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	key, err := totp.NewSecret()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.storage.SaveTOTPSecret(ctx, uuid, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPAlreadyExists) {
+			return "", "", fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+		}
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, totp.URI(s.authCfg.MFAIssuer, user.Username, key), nil
+}
+
+// ConfirmTOTP enables MFA once the user proves the authenticator is set up
+// and returns recovery codes, which are shown only this once
+func (s *Service) ConfirmTOTP(ctx context.Context, uuid, code string) ([]string, error) {
+	const op = "service.auth.ConfirmTOTP"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	t, err := s.storage.TOTP(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrMFANotEnabled)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if t.ConfirmedAt != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+	}
+
+	step, ok := totp.Validate(code, t.Secret, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidMFACode)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.storage.ConfirmTOTP(ctx, uuid, step, hashes)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPAlreadyExists) {
+			return nil, fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns MFA off. An enrollment that was never confirmed is dropped without a code.
+func (s *Service) DisableTOTP(ctx context.Context, uuid, code string) error {
+	const op = "service.auth.DisableTOTP"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	t, err := s.storage.TOTP(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrMFANotEnabled)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if t.ConfirmedAt != nil {
+		err = s.verifySecondFactor(ctx, uuid, code)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = s.storage.DeleteTOTP(ctx, uuid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user, used or not
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, uuid, code string) ([]string, error) {
+	const op = "service.auth.RegenerateRecoveryCodes"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	err := s.verifySecondFactor(ctx, uuid, code)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.storage.ReplaceRecoveryCodes(ctx, uuid, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code.
+// Both are consumed, so neither can be replayed.
+func (s *Service) verifySecondFactor(ctx context.Context, uuid, code string) error {
+	t, err := s.storage.TOTP(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return ErrMFANotEnabled
+		}
+		return err
+	}
+	if t.ConfirmedAt == nil {
+		return ErrMFANotEnabled
+	}
+
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(code, t.Secret, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		err = s.storage.UseTOTPStep(ctx, uuid, step)
+		if err != nil {
+			if errors.Is(err, storage.ErrTOTPStepUsed) {
+				return ErrInvalidMFACode
+			}
+			return err
+		}
+
+		return nil
+	}
+
+	err = s.storage.UseRecoveryCode(ctx, uuid, secret.Hash(normalizeRecoveryCode(code)))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) mfaEnabled(ctx context.Context, uuid string) (bool, error) {
+	t, err := s.storage.TOTP(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return t.ConfirmedAt != nil, nil
+}
+
+// effectiveRole downgrades roles that require MFA to the plain user role
+// until the user enrolls a second factor
+func (s *Service) effectiveRole(role string, mfaEnabled bool) string {
+	if !mfaEnabled && slices.Contains(s.authCfg.MFARequiredRoles, role) {
+		return models.RoleUser
+	}
+
+	return role
+}
+
+// newRecoveryCodes returns codes formatted as xxxx-xxxx-xxxx-xxxx along with their hashes
+func newRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([][]byte, 0, recoveryCodesCount)
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		b, err := secret.Bytes(recoveryCodeSize)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+
+		var parts []string
+		for j := 0; j < len(raw); j += 4 {
+			parts = append(parts, raw[j:min(j+4, len(raw))])
+		}
+
+		codes = append(codes, strings.Join(parts, "-"))
+		hashes = append(hashes, secret.Hash(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+
+	return strings.ToLower(code)
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/rbac"
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+var (
+	ErrPersonalTokenNotFound = errors.New("personal access token not found")
+	ErrInvalidTokenName      = errors.New("invalid token name")
+	ErrInvalidTokenScopes    = errors.New("invalid token scopes")
+	ErrInvalidTokenExpiry    = errors.New("token expiry must be in the future")
+	ErrTooManyPersonalTokens = errors.New("too many personal access tokens")
+	ErrTokenExpired          = errors.New("token is expired")
+)
+
+const (
+	// personalTokenSize is the number of random bytes in a personal access token
+	personalTokenSize = 32
+	// personalTokenPrefixLength is the number of characters of a token kept to recognize it by
+	personalTokenPrefixLength = 12
+	// maxPersonalTokens is the number of tokens a user may have
+	maxPersonalTokens = 50
+	// maxTokenNameLength is the longest token name
+	maxTokenNameLength = 255
+	// personalTokenTouchInterval is how often the last use of a token is recorded,
+	// not to write to the database on every request
+	personalTokenTouchInterval = time.Minute
+)
+
+// CreatePersonalToken issues the user a named token granting the permissions in scopes,
+// all of which the user's role must have. It expires at expiresAt, if given.
+// The token itself is only returned here.
+func (s *Service) CreatePersonalToken(ctx context.Context, uuid, name string, scopes []string, expiresAt *time.Time) (*models.PersonalAccessToken, string, error) {
+	const op = "service.auth.CreatePersonalToken"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxTokenNameLength {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidTokenName)
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidTokenExpiry)
+	}
+
+	user, err := s.storage.UserByUUID(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	mfaEnabled, err := s.mfaEnabled(ctx, uuid)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	role := s.effectiveRole(user.Role, mfaEnabled)
+
+	// A token can't do more than the user who issued it
+	scopes = dedupe(scopes)
+	for _, scope := range scopes {
+		if !rbac.Can(role, rbac.Permission(scope)) {
+			return nil, "", fmt.Errorf("%s: %w: %s", op, ErrInvalidTokenScopes, scope)
+		}
+	}
+
+	tokens, err := s.storage.PersonalAccessTokens(ctx, uuid)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	if len(tokens) >= maxPersonalTokens {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrTooManyPersonalTokens)
+	}
+
+	random, err := secret.New(personalTokenSize)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	token := models.PersonalAccessTokenPrefix + random
+
+	pat := &models.PersonalAccessToken{
+		UserUUID:  uuid,
+		Name:      name,
+		Prefix:    token[:personalTokenPrefixLength],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	err = s.storage.CreatePersonalAccessToken(ctx, pat, secret.Hash(token))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pat, token, nil
+}
+
+// PersonalTokens returns the user's personal access tokens
+func (s *Service) PersonalTokens(ctx context.Context, uuid string) ([]models.PersonalAccessToken, error) {
+	const op = "service.auth.PersonalTokens"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	tokens, err := s.storage.PersonalAccessTokens(ctx, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// DeletePersonalToken revokes the user's personal access token with id
+func (s *Service) DeletePersonalToken(ctx context.Context, uuid, id string) error {
+	const op = "service.auth.DeletePersonalToken"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	err := s.storage.DeletePersonalAccessToken(ctx, uuid, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrPersonalTokenNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrPersonalTokenNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// VerifyPersonalToken returns the personal access token and the role its user has now.
+// Like a login, it fails for blocked users and downgrades roles which require MFA.
+func (s *Service) VerifyPersonalToken(ctx context.Context, token string) (*models.PersonalAccessToken, string, error) {
+	const op = "service.auth.VerifyPersonalToken"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	pat, err := s.storage.PersonalAccessToken(ctx, secret.Hash(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrPersonalTokenNotFound) {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	if pat.Expired(now) {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrTokenExpired)
+	}
+
+	user, err := s.storage.UserByUUID(ctx, pat.UserUUID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Blocked(now) {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	mfaEnabled, err := s.mfaEnabled(ctx, user.UUID)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) >= personalTokenTouchInterval {
+		// Failing to record the use doesn't make the token invalid
+		err = s.storage.TouchPersonalAccessToken(ctx, pat.ID)
+		if err != nil {
+			logger.FromContext(ctx, s.log).Error("failed to record personal access token use", slog.String("op", op), sl.Error(err))
+		}
+	}
+
+	return pat, s.effectiveRole(user.Role, mfaEnabled), nil
+}
+
+func dedupe(s []string) []string {
+	res := make([]string, 0, len(s))
+	for _, v := range s {
+		if !slices.Contains(res, v) {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
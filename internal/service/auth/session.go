@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+// Logout ends the session the refresh token belongs to
+func (s *Service) Logout(ctx context.Context, token string) error {
+	const op = "service.auth.Logout"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	claims, err := jwt.Parse(token, s.keys, jwt.TypeRefresh)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	uuid, err := jwt.GetClaim(claims, "sub")
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	// Tokens issued before sessions were introduced only have themselves to revoke
+	sid := jwt.FamilyID(claims)
+	if sid != "" {
+		err = s.storage.RevokeSession(ctx, uuid, sid)
+		if err != nil {
+			if errors.Is(err, storage.ErrSessionNotFound) {
+				return fmt.Errorf("%s: %w", op, ErrTokenRevoked)
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		err = s.cash.RevokeSessionTokens(ctx, sid, s.tokenCfg.JWT.TTL)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	_, err = s.cash.RevokeToken(ctx, jwt.ID(claims, token), jwt.Remaining(claims))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// LogoutAll ends every session of the user the refresh token belongs to
+func (s *Service) LogoutAll(ctx context.Context, token string) error {
+	const op = "service.auth.LogoutAll"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	claims, err := jwt.Parse(token, s.keys, jwt.TypeRefresh)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	uuid, err := jwt.GetClaim(claims, "sub")
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	// A token which is revoked already may not log anyone out
+	sid := jwt.FamilyID(claims)
+	if sid != "" {
+		err = s.storage.RevokeSession(ctx, uuid, sid)
+		if err != nil {
+			if errors.Is(err, storage.ErrSessionNotFound) {
+				return fmt.Errorf("%s: %w", op, ErrTokenRevoked)
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = jwt.EndSessions(ctx, s.storage, s.cash, uuid, s.tokenCfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Sessions lists the user's active sessions, marking the one with id current
+func (s *Service) Sessions(ctx context.Context, uuid, current string) ([]models.Session, error) {
+	const op = "service.auth.Sessions"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	sessions, err := s.storage.Sessions(ctx, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends one of the user's sessions
+func (s *Service) RevokeSession(ctx context.Context, uuid, id string) error {
+	const op = "service.auth.RevokeSession"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	err := s.storage.RevokeSession(ctx, uuid, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrSessionNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.cash.RevokeSessionTokens(ctx, id, s.tokenCfg.JWT.TTL)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// startSession opens a new session for the user and issues its first token pair under grant
+func (s *Service) startSession(ctx context.Context, user *models.User, client models.Client, grant jwt.Grant) (string, string, error) {
+	jti, err := secret.New(jtiSize)
+	if err != nil {
+		return "", "", err
+	}
+
+	sid, err := s.storage.CreateSession(ctx, user.UUID, jti, client, time.Now().Add(s.tokenCfg.Refresh.TTL))
+	if err != nil {
+		return "", "", err
+	}
+
+	return s.issueTokens(user, sid, jti, grant)
+}
+
+// issueTokens issues an access token of the session sid along with its refresh token jti
+func (s *Service) issueTokens(user *models.User, sid, jti string, grant jwt.Grant) (string, string, error) {
+	accessToken, err := jwt.NewAccessToken(user, sid, grant, s.tokenCfg, s.keys)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := jwt.NewRefreshToken(user, sid, jti, grant, s.tokenCfg, s.keys)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// reportTokenReuse raises a security event about a rotated refresh token of the session
+// being presented again, which means it leaked. The session is already revoked by then,
+// the access tokens issued for it are revoked here.
+func (s *Service) reportTokenReuse(ctx context.Context, uuid, sid string, client models.Client) {
+	const op = "service.auth.reportTokenReuse"
+
+	// The leak is handled even if whoever presented the token goes away
+	ctx, cancel := s.detached(ctx, op)
+	defer cancel()
+
+	log := logger.FromContext(ctx, s.log).With(slog.String("op", op))
+
+	err := s.cash.RevokeSessionTokens(ctx, sid, s.tokenCfg.JWT.TTL)
+	if err != nil {
+		log.Error("failed to revoke access tokens of the session", sl.Error(err))
+	}
+
+	log.Warn("refresh token reused, session revoked",
+		slog.String("uuid", uuid),
+		slog.String("session", sid),
+		slog.String("ip", client.IP),
+	)
+
+	err = s.broker.SecurityEvent(ctx, models.SecurityEvent{
+		Type:       models.EventRefreshTokenReuse,
+		UserUUID:   uuid,
+		SessionID:  sid,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		OccurredAt: time.Now(),
+	})
+	if err != nil {
+		log.Error("failed to publish security event", sl.Error(err))
+	}
+}
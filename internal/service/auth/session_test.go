@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/models"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+var testUser = &models.User{UUID: "0d5ba1c8-3b2f-4d6e-9a55-0f0c8c3f7a10", Username: "alice", Role: models.RoleUser}
+
+// signRefreshToken signs a refresh token with the given claims on top of the usual ones,
+// as the tokens issued by older releases
+func signRefreshToken(t *testing.T, s *Service, claims gojwt.MapClaims) string {
+	t.Helper()
+
+	claims["sub"] = testUser.UUID
+	claims["typ"] = jwt.TypeRefresh
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	return token
+}
+
+func familyOf(t *testing.T, s *Service, token string) string {
+	t.Helper()
+
+	claims, err := jwt.Parse(token, s.keys, jwt.TypeRefresh)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	return jwt.FamilyID(claims)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	storage, cash, broker := newMemoryStorage(testUser), newMemoryCash(), &memoryBroker{}
+	s := newTestService(t, storage, cash, broker)
+
+	_, first, err := s.startSession(ctx, testUser, models.Client{}, jwt.Grant{})
+	if err != nil {
+		t.Fatalf("startSession() error = %v", err)
+	}
+	sid := familyOf(t, s, first)
+
+	_, second, err := s.RefreshToken(ctx, first, models.Client{})
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if got := familyOf(t, s, second); got != sid {
+		t.Fatalf("rotated token belongs to session %q, want %q", got, sid)
+	}
+
+	_, latest, err := s.RefreshToken(ctx, second, models.Client{})
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	// The first token was rotated twice already, someone else must hold it
+	_, _, err = s.RefreshToken(ctx, first, models.Client{})
+	if !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("RefreshToken() with a rotated token error = %v, want %v", err, ErrTokenReused)
+	}
+	if !storage.sessions[sid].revoked {
+		t.Error("session is not revoked after token reuse")
+	}
+	if !cash.sessions[sid] {
+		t.Error("access tokens of the session are not revoked after token reuse")
+	}
+	if len(broker.events) != 1 || broker.events[0].Type != models.EventRefreshTokenReuse {
+		t.Errorf("security events = %+v, want one %s", broker.events, models.EventRefreshTokenReuse)
+	}
+
+	// Whoever held the latest token lost the session too
+	_, _, err = s.RefreshToken(ctx, latest, models.Client{})
+	if !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("RefreshToken() in a revoked session error = %v, want %v", err, ErrTokenRevoked)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	latest := "latest"
+	older := "older"
+
+	tests := []struct {
+		name string
+		// latest is the latest token of the session, nil for sessions started before token families
+		latest *string
+		claims gojwt.MapClaims
+		want   error
+	}{
+		{name: "latest token", latest: &latest, claims: gojwt.MapClaims{"jti": latest}},
+		{name: "latest token named by sid", latest: &latest, claims: gojwt.MapClaims{"jti": latest, "sid": ""}},
+		{name: "rotated token", latest: &latest, claims: gojwt.MapClaims{"jti": older}, want: ErrTokenReused},
+		{name: "rotated token named by sid", latest: &latest, claims: gojwt.MapClaims{"jti": older, "sid": ""}, want: ErrTokenReused},
+		{name: "token without jti", latest: &latest, claims: gojwt.MapClaims{}, want: ErrTokenReused},
+		{name: "session without latest token", claims: gojwt.MapClaims{"sid": ""}},
+		{name: "session without latest token and token with jti", claims: gojwt.MapClaims{"jti": older}, want: ErrTokenReused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := newMemoryStorage(testUser)
+			s := newTestService(t, storage, newMemoryCash(), &memoryBroker{})
+
+			sid, err := storage.CreateSession(ctx, testUser.UUID, "", models.Client{}, time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatalf("CreateSession() error = %v", err)
+			}
+			storage.sessions[sid].latest = tt.latest
+
+			// Tokens name their session either "family_id" or, if older, "sid"
+			if _, ok := tt.claims["sid"]; ok {
+				tt.claims["sid"] = sid
+			} else {
+				tt.claims["family_id"] = sid
+			}
+
+			_, refreshToken, err := s.RefreshToken(ctx, signRefreshToken(t, s, tt.claims), models.Client{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("RefreshToken() error = %v, want %v", err, tt.want)
+			}
+			if tt.want != nil {
+				if !storage.sessions[sid].revoked {
+					t.Error("session is not revoked after token reuse")
+				}
+				return
+			}
+
+			if got := familyOf(t, s, refreshToken); got != sid {
+				t.Errorf("rotated token belongs to session %q, want %q", got, sid)
+			}
+			if len(storage.sessions) != 1 {
+				t.Errorf("%d sessions after rotation, want 1", len(storage.sessions))
+			}
+		})
+	}
+}
+
+func TestRefreshLegacyToken(t *testing.T) {
+	ctx := context.Background()
+	storage := newMemoryStorage(testUser)
+	s := newTestService(t, storage, newMemoryCash(), &memoryBroker{})
+
+	// Tokens issued before sessions belong to no session and have no jti
+	legacy := signRefreshToken(t, s, gojwt.MapClaims{})
+
+	_, refreshToken, err := s.RefreshToken(ctx, legacy, models.Client{})
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	sid := familyOf(t, s, refreshToken)
+	if _, ok := storage.sessions[sid]; !ok {
+		t.Fatalf("legacy token is not moved to a session, got session %q", sid)
+	}
+
+	_, _, err = s.RefreshToken(ctx, legacy, models.Client{})
+	if !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("RefreshToken() with a used legacy token error = %v, want %v", err, ErrTokenRevoked)
+	}
+	if len(storage.sessions) != 1 {
+		t.Errorf("%d sessions after reusing a legacy token, want 1", len(storage.sessions))
+	}
+
+	_, _, err = s.RefreshToken(ctx, refreshToken, models.Client{})
+	if err != nil {
+		t.Errorf("RefreshToken() in the new session error = %v", err)
+	}
+}
+
+func TestRefreshInvalidToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// token makes the refresh token to present
+		token func(t *testing.T, s *Service) string
+		// users are stored, without testUser its token is of a deleted user
+		users []*models.User
+		want  []error
+	}{
+		{
+			name: "expired token",
+			token: func(t *testing.T, s *Service) string {
+				token, err := s.keys.Sign(gojwt.MapClaims{
+					"sub": testUser.UUID,
+					"typ": jwt.TypeRefresh,
+					"iat": time.Now().Add(-2 * time.Hour).Unix(),
+					"exp": time.Now().Add(-time.Hour).Unix(),
+				})
+				if err != nil {
+					t.Fatalf("Sign() error = %v", err)
+				}
+				return token
+			},
+			users: []*models.User{testUser},
+			want:  []error{ErrInvalidToken, jwt.ErrTokenExpired},
+		},
+		{
+			name:  "garbage",
+			token: func(*testing.T, *Service) string { return "garbage" },
+			users: []*models.User{testUser},
+			want:  []error{ErrInvalidToken, jwt.ErrInvalidToken},
+		},
+		{
+			name: "access token",
+			token: func(t *testing.T, s *Service) string {
+				token, err := s.keys.Sign(gojwt.MapClaims{
+					"sub": testUser.UUID,
+					"typ": jwt.TypeAccess,
+					"iat": time.Now().Unix(),
+					"exp": time.Now().Add(time.Hour).Unix(),
+				})
+				if err != nil {
+					t.Fatalf("Sign() error = %v", err)
+				}
+				return token
+			},
+			users: []*models.User{testUser},
+			want:  []error{ErrInvalidToken, jwt.ErrInvalidTokenType},
+		},
+		{
+			name:  "deleted user",
+			token: func(t *testing.T, s *Service) string { return signRefreshToken(t, s, gojwt.MapClaims{}) },
+			want:  []error{ErrTokenRevoked},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, newMemoryStorage(tt.users...), newMemoryCash(), &memoryBroker{})
+
+			_, _, err := s.RefreshToken(context.Background(), tt.token(t, s), models.Client{})
+			for _, want := range tt.want {
+				if !errors.Is(err, want) {
+					t.Errorf("RefreshToken() error = %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/logger/sl"
+	"user-management-service/internal/models"
+)
+
+var (
+	ErrAccountLocked        = errors.New("account is locked")
+	ErrTooManyLoginAttempts = errors.New("too many login attempts")
+)
+
+// ThrottledError is returned by Login when the attempt is rejected without
+// checking the password. Err is ErrAccountLocked or ErrTooManyLoginAttempts.
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ThrottledError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// reserveLogin rejects the login if too many logins failed from the client's address,
+// if the account is locked, or if the user is still to wait after the last failed login.
+// Otherwise the attempt is counted as failed before the password is checked, so that
+// concurrent guesses are throttled like consecutive ones. Attempts which turn out right
+// are taken back by releaseLogin or loginSucceeded.
+func (s *Service) reserveLogin(ctx context.Context, username string, client models.Client) (models.LoginAttempt, error) {
+	if s.authCfg.MaxIPLoginFailures > 0 && client.IP != "" {
+		now := time.Now()
+
+		failures, err := s.cash.LoginFailures(ctx, models.IPLoginSubject(client.IP), s.authCfg.LoginFailureWindow)
+		if err != nil {
+			return models.LoginAttempt{}, err
+		}
+		if n := len(failures); n >= s.authCfg.MaxIPLoginFailures {
+			// The window slides, an attempt is let through once enough of the failures fall out of it
+			oldest := failures[n-s.authCfg.MaxIPLoginFailures]
+			return models.LoginAttempt{}, &ThrottledError{
+				RetryAfter: oldest.Add(s.authCfg.LoginFailureWindow).Sub(now),
+				Err:        ErrTooManyLoginAttempts,
+			}
+		}
+	}
+
+	attempt, err := s.cash.ReserveLoginAttempt(ctx, username, s.authCfg.LoginFailureWindow,
+		loginDelays(s.authCfg.LoginDelay, s.authCfg.MaxLoginDelay))
+	if err != nil {
+		return models.LoginAttempt{}, err
+	}
+	if attempt.LockedFor > 0 {
+		return models.LoginAttempt{}, &ThrottledError{RetryAfter: attempt.LockedFor, Err: ErrAccountLocked}
+	}
+	if attempt.RetryAfter > 0 {
+		return models.LoginAttempt{}, &ThrottledError{RetryAfter: attempt.RetryAfter, Err: ErrTooManyLoginAttempts}
+	}
+
+	return attempt, nil
+}
+
+// loginFailed counts the failed login against the client's address, the account's is
+// counted by reserveLogin already, and locks the account once too many failed. Unknown
+// usernames are counted and locked alike, not to tell which exist. Failing to count
+// doesn't fail the login any further.
+func (s *Service) loginFailed(ctx context.Context, username string, attempt models.LoginAttempt, user *models.User, client models.Client) {
+	const op = "service.auth.loginFailed"
+
+	// Counted even if the client goes away, or aborting the request would dodge the lockout
+	ctx, cancel := s.detached(ctx, op)
+	defer cancel()
+
+	log := logger.FromContext(ctx, s.log).With(slog.String("op", op))
+
+	if client.IP != "" {
+		_, err := s.cash.AddLoginFailure(ctx, models.IPLoginSubject(client.IP), s.authCfg.LoginFailureWindow)
+		if err != nil {
+			log.Error("failed to count failed login of address", sl.Error(err))
+		}
+	}
+
+	if s.authCfg.MaxLoginFailures <= 0 || attempt.Failures < s.authCfg.MaxLoginFailures {
+		return
+	}
+
+	err := s.cash.LockAccount(ctx, username, s.authCfg.LoginLockout)
+	if err != nil {
+		log.Error("failed to lock account", sl.Error(err))
+		return
+	}
+	// Counting starts over once the lock is lifted
+	err = s.cash.ResetLoginFailures(ctx, models.AccountLoginSubject(username))
+	if err != nil {
+		log.Error("failed to reset failed logins", sl.Error(err))
+	}
+
+	log.Warn("too many failed logins, account locked",
+		slog.String("username", username),
+		slog.String("ip", client.IP),
+		slog.Duration("lockout", s.authCfg.LoginLockout),
+	)
+
+	if user == nil {
+		return
+	}
+
+	err = s.broker.SecurityEvent(ctx, models.SecurityEvent{
+		Type:       models.EventAccountLocked,
+		UserUUID:   user.UUID,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		OccurredAt: time.Now(),
+	})
+	if err != nil {
+		log.Error("failed to publish security event", sl.Error(err))
+	}
+}
+
+// releaseLogin takes back the attempt reserved by reserveLogin, which was no failed login
+// after all, e.g. the password was right but the second factor is still to come
+func (s *Service) releaseLogin(ctx context.Context, username string, attempt models.LoginAttempt) {
+	const op = "service.auth.releaseLogin"
+
+	err := s.cash.ReleaseLoginAttempt(ctx, username, attempt.ID)
+	if err != nil {
+		logger.FromContext(ctx, s.log).Error("failed to release login attempt", slog.String("op", op), sl.Error(err))
+	}
+}
+
+// loginSucceeded forgets the failed logins of the account. Those of the address
+// are kept, a single known password must not clear the way for guessing others.
+func (s *Service) loginSucceeded(ctx context.Context, username string) {
+	const op = "service.auth.loginSucceeded"
+
+	err := s.cash.ResetLoginFailures(ctx, models.AccountLoginSubject(username))
+	if err != nil {
+		logger.FromContext(ctx, s.log).Error("failed to reset failed logins", slog.String("op", op), sl.Error(err))
+	}
+}
+
+// loginDelay is how long to wait after the n-th failed login in a row:
+// base after the first, doubled by every further one, up to limit
+func loginDelay(n int, base, limit time.Duration) time.Duration {
+	if n <= 0 || base <= 0 {
+		return 0
+	}
+
+	delay := base
+	for i := 1; i < n && delay < limit; i++ {
+		delay *= 2
+	}
+
+	return min(delay, limit)
+}
+
+// loginDelays lists how long to wait after the first, second and further failed logins
+// in a row, up to the first one reaching limit, which applies to any after it
+func loginDelays(base, limit time.Duration) []time.Duration {
+	var delays []time.Duration
+	for n := 1; ; n++ {
+		delay := loginDelay(n, base, limit)
+		if delay <= 0 {
+			return delays
+		}
+		delays = append(delays, delay)
+		if delay >= limit {
+			return delays
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		name  string
+		n     int
+		base  time.Duration
+		limit time.Duration
+		want  time.Duration
+	}{
+		{name: "no failures", n: 0, base: time.Second, limit: 30 * time.Second, want: 0},
+		{name: "first failure", n: 1, base: time.Second, limit: 30 * time.Second, want: time.Second},
+		{name: "second failure", n: 2, base: time.Second, limit: 30 * time.Second, want: 2 * time.Second},
+		{name: "fifth failure", n: 5, base: time.Second, limit: 30 * time.Second, want: 16 * time.Second},
+		{name: "capped", n: 6, base: time.Second, limit: 30 * time.Second, want: 30 * time.Second},
+		{name: "far beyond cap", n: 1000, base: time.Second, limit: 30 * time.Second, want: 30 * time.Second},
+		{name: "limit below base", n: 1, base: time.Minute, limit: time.Second, want: time.Second},
+		{name: "disabled", n: 3, base: 0, limit: 30 * time.Second, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loginDelay(tt.n, tt.base, tt.limit); got != tt.want {
+				t.Errorf("loginDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginDelays(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  time.Duration
+		limit time.Duration
+		want  []time.Duration
+	}{
+		{name: "doubled up to limit", base: time.Second, limit: 5 * time.Second, want: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}},
+		{name: "limit below base", base: time.Minute, limit: time.Second, want: []time.Duration{time.Second}},
+		{name: "disabled", base: 0, limit: time.Second, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loginDelays(tt.base, tt.limit); !slices.Equal(got, tt.want) {
+				t.Errorf("loginDelays() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newThrottleTest(t *testing.T, auth config.Auth) (*Service, *memoryCash, *memoryBroker) {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword() error = %v", err)
+	}
+	user := *testUser
+	user.PassHash = hash
+
+	cash, broker := newMemoryCash(), &memoryBroker{}
+	s := newTestService(t, newMemoryStorage(&user), cash, broker)
+	s.authCfg = auth
+
+	return s, cash, broker
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	s, cash, broker := newThrottleTest(t, config.Auth{
+		LoginFailureWindow: time.Minute,
+		MaxLoginFailures:   3,
+		LoginLockout:       time.Minute,
+	})
+
+	for i := 0; i < 2; i++ {
+		_, _, err := s.Login(ctx, testUser.Username, "guess", models.Client{})
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Login() with a wrong password error = %v, want %v", err, ErrInvalidCredentials)
+		}
+	}
+
+	// A successful login forgets the failures before it
+	_, _, err := s.Login(ctx, testUser.Username, "password", models.Client{})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if n := len(cash.failures[models.AccountLoginSubject(testUser.Username)]); n != 0 {
+		t.Fatalf("%d failed logins after a successful one, want 0", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, _, err := s.Login(ctx, testUser.Username, "guess", models.Client{})
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Login() with a wrong password error = %v, want %v", err, ErrInvalidCredentials)
+		}
+	}
+	if len(broker.events) != 1 || broker.events[0].Type != models.EventAccountLocked {
+		t.Errorf("security events = %+v, want one %s", broker.events, models.EventAccountLocked)
+	}
+
+	_, _, err = s.Login(ctx, testUser.Username, "password", models.Client{})
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Login() to a locked account error = %v, want %v", err, ErrAccountLocked)
+	}
+	if throttled.RetryAfter <= 0 || throttled.RetryAfter > time.Minute {
+		t.Errorf("RetryAfter = %v, want up to %v", throttled.RetryAfter, time.Minute)
+	}
+}
+
+func TestLoginReservation(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newThrottleTest(t, config.Auth{
+		LoginFailureWindow: time.Minute,
+		LoginDelay:         time.Minute,
+		MaxLoginDelay:      time.Minute,
+	})
+
+	// An attempt counts as failed until its password is checked, concurrent ones have to wait for it
+	attempt, err := s.reserveLogin(ctx, testUser.Username, models.Client{})
+	if err != nil {
+		t.Fatalf("reserveLogin() error = %v", err)
+	}
+	_, _, err = s.Login(ctx, testUser.Username, "password", models.Client{})
+	if !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Fatalf("Login() during another attempt error = %v, want %v", err, ErrTooManyLoginAttempts)
+	}
+
+	// Once it turns out right, the next attempt doesn't wait
+	s.releaseLogin(ctx, testUser.Username, attempt)
+	_, _, err = s.Login(ctx, testUser.Username, "guess", models.Client{})
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login() with a wrong password error = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	// After a failure even the right password has to wait
+	_, _, err = s.Login(ctx, testUser.Username, "password", models.Client{})
+	if !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Errorf("Login() right after a failed one error = %v, want %v", err, ErrTooManyLoginAttempts)
+	}
+}
@@ -0,0 +1,220 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+var (
+	ErrGroupNotFound    = errors.New("group not found")
+	ErrGroupExists      = errors.New("group already exists")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrAlreadyMember    = errors.New("user is already a member of the group")
+	ErrNotMember        = errors.New("user is not a member of the group")
+	ErrInvalidName      = errors.New("invalid group name")
+	ErrNoFieldsToUpdate = errors.New("no fields to update")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 100
+	maxNameLength    = 255
+)
+
+type Storage interface {
+	CreateGroup(ctx context.Context, name, description string) (*models.Group, error)
+	Group(ctx context.Context, id string) (*models.Group, error)
+	Groups(ctx context.Context, member string, limit int, cursor string) ([]models.Group, string, error)
+	UpdateGroup(ctx context.Context, id string, patch models.GroupPatch) (*models.Group, error)
+	DeleteGroup(ctx context.Context, id string) error
+	AddGroupMember(ctx context.Context, groupID, uuid string) error
+	RemoveGroupMember(ctx context.Context, groupID, uuid string) error
+	GroupMembers(ctx context.Context, groupID string, limit int, cursor string) ([]models.User, string, error)
+}
+
+type Service struct {
+	log       *slog.Logger
+	storage   Storage
+	deadlines config.Deadlines
+}
+
+func New(log *slog.Logger, storage Storage, deadlines config.Deadlines) *Service {
+	return &Service{
+		log:       log,
+		storage:   storage,
+		deadlines: deadlines,
+	}
+}
+
+// withDeadline bounds ctx by the deadline of the operation op
+func (s *Service) withDeadline(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.deadlines.For(op))
+}
+
+func (s *Service) Create(ctx context.Context, name, description string) (*models.Group, error) {
+	const op = "service.group.Create"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	name = strings.TrimSpace(name)
+	if !validName(name) {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidName)
+	}
+
+	group, err := s.storage.CreateGroup(ctx, name, description)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return group, nil
+}
+
+func (s *Service) Group(ctx context.Context, id string) (*models.Group, error) {
+	const op = "service.group.Group"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	group, err := s.storage.Group(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return group, nil
+}
+
+// List returns a page of groups, only the ones member belongs to if it is not empty
+func (s *Service) List(ctx context.Context, member string, limit int, cursor string) ([]models.Group, string, error) {
+	const op = "service.group.List"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	groups, next, err := s.storage.Groups(ctx, member, pageLimit(limit), cursor)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return groups, next, nil
+}
+
+func (s *Service) Update(ctx context.Context, id string, patch models.GroupPatch) (*models.Group, error) {
+	const op = "service.group.Update"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	if patch.Name != nil {
+		name := strings.TrimSpace(*patch.Name)
+		if !validName(name) {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidName)
+		}
+		patch.Name = &name
+	}
+
+	group, err := s.storage.UpdateGroup(ctx, id, patch)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return group, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id string) error {
+	const op = "service.group.Delete"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	err := s.storage.DeleteGroup(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return nil
+}
+
+func (s *Service) AddMember(ctx context.Context, groupID, uuid string) error {
+	const op = "service.group.AddMember"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	err := s.storage.AddGroupMember(ctx, groupID, uuid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return nil
+}
+
+func (s *Service) RemoveMember(ctx context.Context, groupID, uuid string) error {
+	const op = "service.group.RemoveMember"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	err := s.storage.RemoveGroupMember(ctx, groupID, uuid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return nil
+}
+
+// Members returns a page of the group's members
+func (s *Service) Members(ctx context.Context, groupID string, limit int, cursor string) ([]models.User, string, error) {
+	const op = "service.group.Members"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	users, next, err := s.storage.GroupMembers(ctx, groupID, pageLimit(limit), cursor)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return users, next, nil
+}
+
+// mapError translates storage errors to the ones of the service
+func mapError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrGroupNotFound):
+		return ErrGroupNotFound
+	case errors.Is(err, storage.ErrGroupExists):
+		return ErrGroupExists
+	case errors.Is(err, storage.ErrUserNotFound):
+		return ErrUserNotFound
+	case errors.Is(err, storage.ErrAlreadyMember):
+		return ErrAlreadyMember
+	case errors.Is(err, storage.ErrNotMember):
+		return ErrNotMember
+	case errors.Is(err, storage.ErrNoFieldsToUpdate):
+		return ErrNoFieldsToUpdate
+	case errors.Is(err, storage.ErrInvalidCursor):
+		return ErrInvalidCursor
+	}
+
+	return err
+}
+
+func validName(name string) bool {
+	return name != "" && len(name) <= maxNameLength
+}
+
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return defaultListLimit
+	}
+	return min(limit, maxListLimit)
+}
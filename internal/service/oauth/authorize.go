@@ -0,0 +1,270 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+// codeChallengeS256 is the only PKCE method accepted, plain challenges
+// would give the code away to whoever sees the authorization request
+const codeChallengeS256 = "S256"
+
+// AuthorizeRequest holds the parameters of an authorization request (RFC 6749 4.1.1, RFC 7636 4.3)
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// Authorization is the outcome of an authorization request. Either the user is
+// sent back to the client at RedirectURI, or asked whether to allow Client Scopes.
+type Authorization struct {
+	RedirectURI     string
+	ConsentRequired bool
+	Client          *models.OAuthClient
+	Scopes          []string
+}
+
+// Authorize issues an authorization code to the client if the user allowed it the
+// requested scopes before, otherwise the user's consent is required.
+// Errors the client can be told about are returned as *RedirectError.
+func (s *Service) Authorize(ctx context.Context, uuid string, req AuthorizeRequest) (*Authorization, error) {
+	const op = "service.oauth.Authorize"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	client, redirectURI, scopes, err := s.validateAuthorize(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	consent, err := s.storage.Consent(ctx, uuid, client.ID)
+	if err != nil && !errors.Is(err, storage.ErrConsentNotFound) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if consent == nil || !subset(scopes, consent.Scopes) {
+		return &Authorization{
+			ConsentRequired: true,
+			Client:          client,
+			Scopes:          scopes,
+		}, nil
+	}
+
+	redirect, err := s.issueCode(ctx, uuid, client, redirectURI, scopes, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Authorization{RedirectURI: redirect}, nil
+}
+
+// Consent records the user's answer to the authorization request. If the user
+// approved it, the scopes are allowed to the client from now on and a code is issued.
+func (s *Service) Consent(ctx context.Context, uuid string, req AuthorizeRequest, approved bool) (*Authorization, error) {
+	const op = "service.oauth.Consent"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	client, redirectURI, scopes, err := s.validateAuthorize(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !approved {
+		return nil, fmt.Errorf("%s: %w", op, redirectError(redirectURI, req.State, ErrAccessDenied))
+	}
+
+	// Scopes allowed before stay allowed
+	allowed := scopes
+	consent, err := s.storage.Consent(ctx, uuid, client.ID)
+	if err != nil && !errors.Is(err, storage.ErrConsentNotFound) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if consent != nil {
+		allowed = dedupe(append(slices.Clone(consent.Scopes), scopes...))
+	}
+
+	err = s.storage.SaveConsent(ctx, uuid, client.ID, allowed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	redirect, err := s.issueCode(ctx, uuid, client, redirectURI, scopes, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Authorization{RedirectURI: redirect}, nil
+}
+
+// validateAuthorize checks the authorization request and returns the client, the
+// redirect uri to send the user back to and the requested scopes. Until the redirect
+// uri is known to belong to the client, errors can't be reported to it.
+func (s *Service) validateAuthorize(ctx context.Context, req AuthorizeRequest) (*models.OAuthClient, string, []string, error) {
+	client, err := s.client(ctx, req.ClientID)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	// Registered redirect uris are matched exactly, not to be tricked into sending the code elsewhere
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return nil, "", nil, ErrInvalidRedirectURI
+	}
+
+	fail := func(err error) (*models.OAuthClient, string, []string, error) {
+		return nil, "", nil, redirectError(redirectURI, req.State, err)
+	}
+
+	if req.ResponseType != "code" {
+		return fail(ErrUnsupportedResponseType)
+	}
+	if !slices.Contains(client.GrantTypes, models.GrantAuthorizationCode) {
+		return fail(ErrUnauthorizedClient)
+	}
+	if req.CodeChallengeMethod != codeChallengeS256 || !validPKCE(req.CodeChallenge) {
+		return fail(ErrCodeChallengeRequired)
+	}
+
+	scopes, err := requestedScopes(req.Scope, client)
+	if err != nil {
+		return fail(err)
+	}
+
+	return client, redirectURI, scopes, nil
+}
+
+// issueCode issues an authorization code and returns the uri the user is sent back to the client with
+func (s *Service) issueCode(ctx context.Context, uuid string, client *models.OAuthClient, redirectURI string, scopes []string, req AuthorizeRequest) (string, error) {
+	// Only the hash is stored, the code itself goes to the client
+	code, err := secret.New(codeSize)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.storage.CreateAuthorizationCode(ctx, secret.Hash(code), models.AuthorizationCode{
+		ClientID:      client.ID,
+		UserUUID:      uuid,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		ExpiresAt:     time.Now().Add(s.oauthCfg.CodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return withQuery(redirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+	}), nil
+}
+
+// requestedScopes returns the scopes asked for in scope, all of which must be
+// registered for the client. Without any the client gets all of its scopes.
+func requestedScopes(scope string, client *models.OAuthClient) ([]string, error) {
+	scopes := dedupe(strings.Fields(scope))
+	if len(scopes) == 0 {
+		return slices.Clone(client.Scopes), nil
+	}
+
+	if !subset(scopes, client.Scopes) {
+		return nil, ErrInvalidScope
+	}
+
+	return scopes, nil
+}
+
+// validPKCE checks that s is made of 43 to 128 unreserved characters,
+// as both code verifiers and S256 code challenges are
+func validPKCE(s string) bool {
+	if len(s) < 43 || len(s) > 128 {
+		return false
+	}
+
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// verifyPKCE checks that the code verifier is the one the S256 challenge was made of
+func verifyPKCE(challenge, verifier string) bool {
+	if !validPKCE(verifier) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func redirectError(redirectURI, state string, err error) *RedirectError {
+	return &RedirectError{
+		RedirectURI: withQuery(redirectURI, url.Values{
+			"error":             {ErrorCode(err)},
+			"error_description": {ErrorDescription(err)},
+			"state":             {state},
+		}),
+		Err: err,
+	}
+}
+
+// withQuery adds the non-empty params to the query of uri, which is a registered redirect uri
+func withQuery(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q.Set(k, v[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// subset reports whether every scope of a is in b
+func subset(a, b []string) bool {
+	for _, scope := range a {
+		if !slices.Contains(b, scope) {
+			return false
+		}
+	}
+
+	return true
+}
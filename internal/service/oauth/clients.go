@@ -0,0 +1,186 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+// ClientRegistration is the metadata of a client to register
+type ClientRegistration struct {
+	Name         string
+	RedirectURIs []string
+	GrantTypes   []string
+	Scopes       []string
+	Public       bool
+}
+
+// CreateClient registers a client and returns it along with its secret, which is
+// only known at this point. Public clients get no secret. Without grant types the
+// client may use the authorization code and refresh token grants.
+func (s *Service) CreateClient(ctx context.Context, reg ClientRegistration) (*models.OAuthClient, string, error) {
+	const op = "service.oauth.CreateClient"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	client := &models.OAuthClient{
+		Name:         strings.TrimSpace(reg.Name),
+		RedirectURIs: dedupe(reg.RedirectURIs),
+		GrantTypes:   dedupe(reg.GrantTypes),
+		Scopes:       dedupe(reg.Scopes),
+		Public:       reg.Public,
+	}
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{models.GrantAuthorizationCode, models.GrantRefreshToken}
+	}
+
+	err := validClient(client)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Ids starting like the ones of service accounts would be taken for them
+	for client.ID == "" || strings.HasPrefix(client.ID, models.ServiceAccountIDPrefix) {
+		client.ID, err = secret.New(clientIDSize)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// Only the hash is stored, the secret is handed to whoever registers the client
+	var clientSecret string
+	if !client.Public {
+		clientSecret, err = secret.New(clientSecretSize)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		client.SecretHash = secret.Hash(clientSecret)
+	}
+
+	err = s.storage.CreateOAuthClient(ctx, client)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return client, clientSecret, nil
+}
+
+func (s *Service) Clients(ctx context.Context) ([]models.OAuthClient, error) {
+	const op = "service.oauth.Clients"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	clients, err := s.storage.OAuthClients(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return clients, nil
+}
+
+// DeleteClient deletes the client. The tokens issued to it can't be refreshed anymore.
+func (s *Service) DeleteClient(ctx context.Context, id string) error {
+	const op = "service.oauth.DeleteClient"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	err := s.storage.DeleteOAuthClient(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrClientNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrClientNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func validClient(client *models.OAuthClient) error {
+	if client.Name == "" || len(client.Name) > maxNameLength {
+		return ErrInvalidClientName
+	}
+
+	for _, grantType := range client.GrantTypes {
+		switch grantType {
+		case models.GrantAuthorizationCode, models.GrantRefreshToken:
+		case models.GrantClientCredentials:
+			// Anyone could act as a client which can't keep a secret
+			if client.Public {
+				return ErrInvalidGrantTypes
+			}
+		default:
+			return ErrInvalidGrantTypes
+		}
+	}
+
+	// Refresh tokens are only issued along with the tokens of an authorization code
+	authorizationCode := slices.Contains(client.GrantTypes, models.GrantAuthorizationCode)
+	if slices.Contains(client.GrantTypes, models.GrantRefreshToken) && !authorizationCode {
+		return ErrInvalidGrantTypes
+	}
+
+	if authorizationCode && len(client.RedirectURIs) == 0 {
+		return ErrInvalidRedirectURIs
+	}
+	for _, uri := range client.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return ErrInvalidRedirectURIs
+		}
+	}
+
+	for _, scope := range client.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return ErrInvalidScope
+		}
+	}
+
+	return nil
+}
+
+// validRedirectURI accepts absolute URIs without a fragment: https ones, plain
+// http ones on the loopback interface and the private-use schemes of native apps
+// (RFC 8252), such as com.example.app:/callback
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" || strings.Contains(uri, "*") {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+
+	return strings.Contains(u.Scheme, ".")
+}
+
+// dedupe drops empty and repeated values keeping the order
+func dedupe(values []string) []string {
+	res := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v != "" && !slices.Contains(res, v) {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
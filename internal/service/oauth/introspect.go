@@ -0,0 +1,185 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/service/auth"
+	"user-management-service/internal/storage"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+// Token type hints of introspection and revocation requests (RFC 7009 2.1)
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// TokenCheckRequest holds the parameters of an introspection or revocation request (RFC 7662 2.1, RFC 7009 2.1)
+type TokenCheckRequest struct {
+	ClientID      string
+	ClientSecret  string
+	Token         string
+	TokenTypeHint string
+}
+
+// Introspection is what the service knows about a token (RFC 7662 2.2).
+// Nothing but Active is told about inactive ones.
+type Introspection struct {
+	Active        bool
+	TokenType     string
+	PrincipalType string
+	Subject       string
+	ClientID      string
+	Role          string
+	Scope         []string
+	ExpiresAt     time.Time
+	IssuedAt      time.Time
+}
+
+// Introspect tells a confidential client whether the token is active, that is
+// issued by the service, not expired and not revoked, and what it was issued for.
+// Resource servers use it to validate tokens without sharing the signing keys.
+func (s *Service) Introspect(ctx context.Context, req TokenCheckRequest) (*Introspection, error) {
+	const op = "service.oauth.Introspect"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	client, err := s.authenticate(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// Anybody can pose as a public client, they would learn about tokens they found
+	if client.Public {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidClient)
+	}
+	if req.Token == "" {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidRequest)
+	}
+
+	typ, claims := parseToken(req.Token, req.TokenTypeHint, s.keys)
+	if claims == nil {
+		return &Introspection{}, nil
+	}
+
+	uuid, _ := claims["sub"].(string)
+	active, err := s.active(ctx, typ, uuid, claims)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !active {
+		return &Introspection{}, nil
+	}
+
+	grant := jwt.GrantFromClaims(claims)
+	role, _ := claims["role"].(string)
+	introspection := &Introspection{
+		Active:        true,
+		TokenType:     typ,
+		PrincipalType: jwt.PrincipalType(claims),
+		Subject:       uuid,
+		ClientID:      grant.ClientID,
+		Role:          role,
+		Scope:         grant.Scope,
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		introspection.ExpiresAt = exp.Time
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		introspection.IssuedAt = iat.Time
+	}
+
+	return introspection, nil
+}
+
+// Revoke revokes a token the client was issued. Revoking a refresh token ends the
+// session it belongs to, with every access token of it (RFC 7009 2.1). Invalid
+// tokens and the tokens of other clients are left alone, the client isn't told.
+func (s *Service) Revoke(ctx context.Context, req TokenCheckRequest) error {
+	const op = "service.oauth.Revoke"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	client, err := s.authenticate(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if req.Token == "" {
+		return fmt.Errorf("%s: %w", op, ErrInvalidRequest)
+	}
+
+	typ, claims := parseToken(req.Token, req.TokenTypeHint, s.keys)
+	if claims == nil || jwt.GrantFromClaims(claims).ClientID != client.ID {
+		return nil
+	}
+
+	if typ == TokenTypeRefresh {
+		err = s.auth.Logout(ctx, req.Token)
+		if err != nil && !errors.Is(err, auth.ErrInvalidToken) && !errors.Is(err, auth.ErrTokenRevoked) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	_, err = s.cash.RevokeToken(ctx, jwt.ID(claims, req.Token), jwt.Remaining(claims))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// active reports whether the token was not revoked. A refresh token is also
+// inactive once its session ended or it was rotated.
+func (s *Service) active(ctx context.Context, typ, uuid string, claims gojwt.MapClaims) (bool, error) {
+	revoked, err := jwt.Revoked(ctx, s.cash, uuid, claims)
+	if err != nil || revoked {
+		return false, err
+	}
+
+	family := jwt.FamilyID(claims)
+	if typ != TokenTypeRefresh || family == "" {
+		return true, nil
+	}
+
+	session, err := s.storage.Session(ctx, uuid, family)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	jti, _ := claims["jti"].(string)
+	// Sessions started before token families don't know their latest token
+	return session.RefreshJTI == "" || session.RefreshJTI == jti, nil
+}
+
+// parseToken verifies the token as the type hinted first, then as the other one
+// (RFC 7662 2.1). It returns nil claims for a token that is invalid or expired.
+func parseToken(token, hint string, keys *jwt.KeySet) (string, gojwt.MapClaims) {
+	types := []string{TokenTypeAccess, TokenTypeRefresh}
+	if hint == TokenTypeRefresh {
+		types = []string{TokenTypeRefresh, TokenTypeAccess}
+	}
+
+	for _, typ := range types {
+		jwtType := jwt.TypeAccess
+		if typ == TokenTypeRefresh {
+			jwtType = jwt.TypeRefresh
+		}
+
+		claims, err := jwt.Parse(token, keys, jwtType)
+		if err == nil {
+			return typ, claims
+		}
+	}
+
+	return "", nil
+}
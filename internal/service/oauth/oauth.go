@@ -0,0 +1,217 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/models"
+	"user-management-service/internal/service/auth"
+	"user-management-service/internal/storage"
+)
+
+// Errors of the authorization and token endpoints, see ErrorCode for their codes in RFC 6749
+var (
+	ErrInvalidRequest          = errors.New("invalid request")
+	ErrInvalidClient           = errors.New("invalid client")
+	ErrInvalidGrant            = errors.New("invalid grant")
+	ErrUnauthorizedClient      = errors.New("client is not allowed to use the grant type")
+	ErrUnsupportedGrantType    = errors.New("unsupported grant type")
+	ErrUnsupportedResponseType = errors.New("unsupported response type")
+	ErrInvalidScope            = errors.New("invalid scope")
+	ErrAccessDenied            = errors.New("access denied")
+	ErrInvalidRedirectURI      = errors.New("invalid redirect uri")
+	ErrCodeChallengeRequired   = errors.New("S256 code challenge required")
+)
+
+// Errors of client registration
+var (
+	ErrClientNotFound      = errors.New("oauth client not found")
+	ErrInvalidClientName   = errors.New("invalid client name")
+	ErrInvalidGrantTypes   = errors.New("invalid grant types")
+	ErrInvalidRedirectURIs = errors.New("invalid redirect uris")
+)
+
+const (
+	// clientIDSize is the number of random bytes in a client id
+	clientIDSize = 16
+	// clientSecretSize is the number of random bytes in a client secret
+	clientSecretSize = 32
+	// codeSize is the number of random bytes in an authorization code
+	codeSize = 32
+	// maxNameLength is the longest client name
+	maxNameLength = 255
+)
+
+// Scopes the clients may be registered for
+var Scopes = []string{
+	ScopeOpenID,
+	ScopeProfile,
+	ScopeEmail,
+	ScopePhone,
+	jwt.ScopeRoles,
+}
+
+// OpenID Connect scopes, openid asks for an ID token and the others for claims about the user
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+)
+
+type Storage interface {
+	UserByUUID(ctx context.Context, uuid string) (*models.User, error)
+	ServiceAccount(ctx context.Context, id string) (*models.ServiceAccount, error)
+	Session(ctx context.Context, uuid, id string) (*models.Session, error)
+	CreateOAuthClient(ctx context.Context, client *models.OAuthClient) error
+	OAuthClient(ctx context.Context, id string) (*models.OAuthClient, error)
+	OAuthClients(ctx context.Context) ([]models.OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, id string) error
+	CreateAuthorizationCode(ctx context.Context, codeHash []byte, code models.AuthorizationCode) error
+	UseAuthorizationCode(ctx context.Context, codeHash []byte) (*models.AuthorizationCode, error)
+	Consent(ctx context.Context, uuid, clientID string) (*models.Consent, error)
+	SaveConsent(ctx context.Context, uuid, clientID string, scopes []string) error
+}
+
+// Auth opens and refreshes the sessions tokens are issued for
+type Auth interface {
+	StartGrant(ctx context.Context, uuid string, grant jwt.Grant, client models.Client) (string, string, error)
+	RefreshGrant(ctx context.Context, token, clientID string, client models.Client) (string, string, error)
+	Logout(ctx context.Context, token string) error
+}
+
+// Cash is the denylist of revoked tokens
+type Cash interface {
+	jwt.Denylist
+	RevokeToken(ctx context.Context, id string, ttl time.Duration) (bool, error)
+}
+
+type Service struct {
+	log       *slog.Logger
+	storage   Storage
+	cash      Cash
+	auth      Auth
+	keys      *jwt.KeySet
+	tokenCfg  config.Token
+	oauthCfg  config.OAuth
+	deadlines config.Deadlines
+}
+
+func New(log *slog.Logger, storage Storage, cash Cash, auth Auth, keys *jwt.KeySet, token config.Token, oauth config.OAuth, deadlines config.Deadlines) *Service {
+	return &Service{
+		log:       log,
+		storage:   storage,
+		cash:      cash,
+		auth:      auth,
+		keys:      keys,
+		tokenCfg:  token,
+		oauthCfg:  oauth,
+		deadlines: deadlines,
+	}
+}
+
+// withDeadline bounds ctx by the deadline of the operation op
+func (s *Service) withDeadline(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.deadlines.For(op))
+}
+
+// errorCodes maps the service errors to their RFC 6749 error codes
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrInvalidClient, "invalid_client"},
+	{ErrInvalidGrant, "invalid_grant"},
+	{ErrUnauthorizedClient, "unauthorized_client"},
+	{ErrUnsupportedGrantType, "unsupported_grant_type"},
+	{ErrUnsupportedResponseType, "unsupported_response_type"},
+	{ErrInvalidScope, "invalid_scope"},
+	{ErrAccessDenied, "access_denied"},
+	{ErrCodeChallengeRequired, "invalid_request"},
+	{ErrInvalidRedirectURI, "invalid_request"},
+	{ErrInvalidRequest, "invalid_request"},
+}
+
+// ErrorCode returns the RFC 6749 error code of a service error
+func ErrorCode(err error) string {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e.code
+		}
+	}
+
+	return "server_error"
+}
+
+// ErrorDescription returns the message of a service error, which is safe to show to clients
+func ErrorDescription(err error) string {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e.err.Error()
+		}
+	}
+
+	return "internal error"
+}
+
+// RedirectError is a failed authorization request the client is told about at its redirect uri
+type RedirectError struct {
+	RedirectURI string
+	Err         error
+}
+
+func (e *RedirectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RedirectError) Unwrap() error {
+	return e.Err
+}
+
+// Token is the response of the token endpoint
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	ExpiresIn    time.Duration
+	Scope        []string
+}
+
+// client returns the registered client with id
+func (s *Service) client(ctx context.Context, id string) (*models.OAuthClient, error) {
+	client, err := s.storage.OAuthClient(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrClientNotFound) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// grantError tells the errors of a token the client is not entitled to from the others
+func grantError(err error) error {
+	for _, e := range []error{
+		auth.ErrInvalidToken,
+		auth.ErrTokenRevoked,
+		auth.ErrTokenReused,
+		auth.ErrUserBlocked,
+		auth.ErrUserNotFound,
+		storage.ErrUserNotFound,
+		jwt.ErrInvalidToken,
+		jwt.ErrInvalidTokenType,
+		jwt.ErrTokenExpired,
+	} {
+		if errors.Is(err, e) {
+			return fmt.Errorf("%w: %w", ErrInvalidGrant, err)
+		}
+	}
+
+	return err
+}
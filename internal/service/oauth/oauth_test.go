@@ -0,0 +1,129 @@
+package oauth
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/models"
+)
+
+// RFC 7636 appendix B
+func TestVerifyPKCE(t *testing.T) {
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name     string
+		verifier string
+		want     bool
+	}{
+		{name: "matching verifier", verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", want: true},
+		{name: "other verifier", verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXl", want: false},
+		{name: "challenge as verifier", verifier: challenge, want: false},
+		{name: "too short", verifier: "dBjftJeZ4CVP", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(challenge, tt.verifier); got != tt.want {
+				t.Errorf("verifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{uri: "https://app.example.com/callback", want: true},
+		{uri: "http://127.0.0.1:8080/callback", want: true},
+		{uri: "http://localhost/callback", want: true},
+		{uri: "com.example.app:/callback", want: true},
+		{uri: "http://app.example.com/callback", want: false},
+		{uri: "https://app.example.com/callback#token", want: false},
+		{uri: "https://*.example.com/callback", want: false},
+		{uri: "/callback", want: false},
+		{uri: "javascript:alert(1)", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if got := validRedirectURI(tt.uri); got != tt.want {
+				t.Errorf("validRedirectURI() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserClaims(t *testing.T) {
+	verified := time.Now()
+	user := &models.User{
+		UUID:            "8f2b5c9e-4a8d-4f4b-9a39-6c1b6f0e2d7a",
+		Username:        "jdoe",
+		Name:            "John",
+		Surname:         "Doe",
+		Email:           "jdoe@example.com",
+		EmailVerifiedAt: &verified,
+		PhoneNumber:     "+15550100",
+		Groups:          []string{"staff"},
+	}
+
+	tests := []struct {
+		name   string
+		scopes []string
+		want   []string
+	}{
+		{name: "openid only", scopes: []string{ScopeOpenID}, want: []string{"sub"}},
+		{name: "email", scopes: []string{ScopeOpenID, ScopeEmail}, want: []string{"sub", "email", "email_verified"}},
+		{name: "phone", scopes: []string{ScopeOpenID, ScopePhone}, want: []string{"sub", "phone_number"}},
+		{
+			name:   "profile",
+			scopes: []string{ScopeOpenID, ScopeProfile},
+			want:   []string{"sub", "name", "given_name", "family_name", "preferred_username"},
+		},
+		{name: "roles", scopes: []string{ScopeOpenID, jwt.ScopeRoles}, want: []string{"sub", "groups"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := userClaims(user, tt.scopes)
+
+			got := make([]string, 0, len(claims))
+			for claim := range claims {
+				got = append(got, claim)
+			}
+			slices.Sort(got)
+			want := slices.Clone(tt.want)
+			slices.Sort(want)
+
+			if !slices.Equal(got, want) {
+				t.Errorf("userClaims() claims = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestServiceAccountID(t *testing.T) {
+	tests := []struct {
+		name string
+		req  TokenRequest
+		want string
+	}{
+		{name: "service account", req: TokenRequest{ClientID: "sa_abc"}, want: "sa_abc"},
+		{name: "oauth client", req: TokenRequest{ClientID: "abc"}, want: ""},
+		{
+			name: "named by assertion",
+			// {"alg":"none"}.{"iss":"sa_abc"}.
+			req:  TokenRequest{ClientAssertion: "eyJhbGciOiJub25lIn0.eyJpc3MiOiJzYV9hYmMifQ."},
+			want: "sa_abc",
+		},
+		{name: "malformed assertion", req: TokenRequest{ClientAssertion: "sa_abc"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serviceAccountID(tt.req); got != tt.want {
+				t.Errorf("serviceAccountID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
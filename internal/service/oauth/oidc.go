@@ -0,0 +1,101 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// UserInfo returns the claims about the user the access token's grant covers
+// (OIDC Core 5.3). Tokens of the service's own login see every claim.
+func (s *Service) UserInfo(ctx context.Context, uuid string, grant jwt.Grant) (map[string]interface{}, error) {
+	const op = "service.oauth.UserInfo"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	scopes := grant.Scope
+	if grant.ClientID == "" {
+		scopes = Scopes
+	}
+	if !slices.Contains(scopes, ScopeOpenID) {
+		return nil, fmt.Errorf("%s: %w", op, ErrInsufficientScope)
+	}
+
+	user, err := s.storage.UserByUUID(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userClaims(user, scopes), nil
+}
+
+// idToken issues the ID token for the authorization code's user, with the claims the code's scopes cover
+func (s *Service) idToken(ctx context.Context, code *models.AuthorizationCode) (string, error) {
+	user, err := s.storage.UserByUUID(ctx, code.UserUUID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", fmt.Errorf("%w: %w", ErrInvalidGrant, err)
+		}
+		return "", err
+	}
+
+	return jwt.NewIDToken(userClaims(user, code.Scopes), code.ClientID, code.Nonce, s.oauthCfg.Issuer, s.tokenCfg, s.keys)
+}
+
+// userClaims maps the user to the standard claims (OIDC Core 5.1) of scopes.
+// Empty ones are left out.
+func userClaims(user *models.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": user.UUID,
+	}
+	set := func(claim, value string) {
+		if value != "" {
+			claims[claim] = value
+		}
+	}
+
+	if slices.Contains(scopes, ScopeProfile) {
+		set("name", strings.TrimSpace(user.Name+" "+user.Surname))
+		set("given_name", user.Name)
+		set("family_name", user.Surname)
+		set("preferred_username", user.Username)
+		if user.ModifiedAt != nil {
+			claims["updated_at"] = user.ModifiedAt.Unix()
+		}
+	}
+
+	if slices.Contains(scopes, ScopeEmail) && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerifiedAt != nil
+	}
+
+	if slices.Contains(scopes, ScopePhone) {
+		set("phone_number", user.PhoneNumber)
+	}
+
+	// Group names are as sensitive as the role, which is granted along with them
+	if slices.Contains(scopes, jwt.ScopeRoles) {
+		groups := user.Groups
+		if groups == nil {
+			groups = []string{}
+		}
+		claims["groups"] = groups
+	}
+
+	return claims
+}
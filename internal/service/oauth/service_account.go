@@ -0,0 +1,104 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+// ClientAssertionTypeJWT is the only client assertion type accepted (RFC 7523 2.2)
+const ClientAssertionTypeJWT = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// serviceAccountID returns the id of the service account making the token request, if it is one.
+// An account authenticating with an assertion may leave client_id out, the assertion names it.
+func serviceAccountID(req TokenRequest) string {
+	id := req.ClientID
+	if id == "" && req.ClientAssertion != "" {
+		id = jwt.AssertionIssuer(req.ClientAssertion)
+	}
+
+	if !strings.HasPrefix(id, models.ServiceAccountIDPrefix) {
+		return ""
+	}
+
+	return id
+}
+
+// serviceAccountToken authenticates the service account and issues it an access token.
+// Service accounts act on their own behalf, with the client credentials grant only.
+func (s *Service) serviceAccountToken(ctx context.Context, id string, req TokenRequest) (*Token, error) {
+	if req.GrantType != models.GrantClientCredentials {
+		return nil, ErrUnauthorizedClient
+	}
+
+	account, err := s.authenticateServiceAccount(ctx, id, req)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := jwt.NewServiceAccountToken(account, s.tokenCfg, s.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		AccessToken: accessToken,
+		ExpiresIn:   s.tokenCfg.JWT.TTL,
+	}, nil
+}
+
+// authenticateServiceAccount checks the account's client secret,
+// or the assertion signed with its private key (RFC 7523 2.2)
+func (s *Service) authenticateServiceAccount(ctx context.Context, id string, req TokenRequest) (*models.ServiceAccount, error) {
+	account, err := s.storage.ServiceAccount(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+
+	if req.ClientAssertion == "" && req.ClientAssertionType == "" {
+		if account.SecretHash == nil || subtle.ConstantTimeCompare(secret.Hash(req.ClientSecret), account.SecretHash) != 1 {
+			return nil, ErrInvalidClient
+		}
+		return account, nil
+	}
+
+	// Using both credentials at once is not allowed (RFC 6749 2.3)
+	if req.ClientAssertionType != ClientAssertionTypeJWT || req.ClientSecret != "" || account.PublicKey == "" {
+		return nil, ErrInvalidClient
+	}
+
+	claims, err := jwt.ParseAssertion(req.ClientAssertion, account.PublicKey, account.ID, s.assertionAudiences())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidClient, err)
+	}
+
+	// An assertion is used once, whoever sees it on the way can't replay it
+	jti, _ := claims["jti"].(string)
+	ok, err := s.cash.RevokeToken(ctx, "assertion:"+account.ID+":"+jti, jwt.Remaining(claims))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: assertion reused", ErrInvalidClient)
+	}
+
+	return account, nil
+}
+
+// assertionAudiences are the values the audience of a client assertion
+// may have: the token endpoint or the issuer
+func (s *Service) assertionAudiences() []string {
+	issuer := strings.TrimSuffix(s.oauthCfg.Issuer, "/")
+
+	return []string{issuer + "/oauth/token", issuer}
+}
@@ -0,0 +1,187 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+// TokenRequest holds the parameters of a token request (RFC 6749 4.1.3, 4.4.2, 6)
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+
+	ClientAssertionType string
+	ClientAssertion     string
+}
+
+// Token authenticates the client and issues tokens for the grant it presents
+func (s *Service) Token(ctx context.Context, req TokenRequest, from models.Client) (*Token, error) {
+	const op = "service.oauth.Token"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	switch req.GrantType {
+	case models.GrantAuthorizationCode, models.GrantRefreshToken, models.GrantClientCredentials:
+	default:
+		return nil, fmt.Errorf("%s: %w", op, ErrUnsupportedGrantType)
+	}
+
+	if id := serviceAccountID(req); id != "" {
+		token, err := s.serviceAccountToken(ctx, id, req)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return token, nil
+	}
+
+	client, err := s.authenticate(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !slices.Contains(client.GrantTypes, req.GrantType) {
+		return nil, fmt.Errorf("%s: %w", op, ErrUnauthorizedClient)
+	}
+
+	var token *Token
+	switch req.GrantType {
+	case models.GrantAuthorizationCode:
+		token, err = s.exchangeCode(ctx, client, req, from)
+	case models.GrantRefreshToken:
+		token, err = s.refresh(ctx, client, req, from)
+	case models.GrantClientCredentials:
+		token, err = s.clientCredentials(client, req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+// authenticate checks the client's secret. Public clients have none and
+// prove that they are the ones who started the flow with PKCE instead.
+func (s *Service) authenticate(ctx context.Context, id, clientSecret string) (*models.OAuthClient, error) {
+	if id == "" {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := s.client(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Public {
+		if clientSecret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare(secret.Hash(clientSecret), client.SecretHash) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+func (s *Service) exchangeCode(ctx context.Context, client *models.OAuthClient, req TokenRequest, from models.Client) (*Token, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, ErrInvalidRequest
+	}
+
+	code, err := s.storage.UseAuthorizationCode(ctx, secret.Hash(req.Code))
+	if err != nil {
+		if errors.Is(err, storage.ErrCodeNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidGrant, err)
+		}
+		return nil, err
+	}
+
+	// The code is used up by now, whoever got hold of it can't try again
+	if code.ClientID != client.ID || code.RedirectURI != req.RedirectURI {
+		return nil, ErrInvalidGrant
+	}
+	if !verifyPKCE(code.CodeChallenge, req.CodeVerifier) {
+		return nil, fmt.Errorf("%w: code verifier mismatch", ErrInvalidGrant)
+	}
+
+	grant := jwt.Grant{ClientID: client.ID, Scope: code.Scopes}
+	accessToken, refreshToken, err := s.auth.StartGrant(ctx, code.UserUUID, grant, from)
+	if err != nil {
+		return nil, grantError(err)
+	}
+
+	if !slices.Contains(client.GrantTypes, models.GrantRefreshToken) {
+		refreshToken = ""
+	}
+
+	var idToken string
+	if slices.Contains(code.Scopes, ScopeOpenID) {
+		idToken, err = s.idToken(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		IDToken:      idToken,
+		ExpiresIn:    s.tokenCfg.JWT.TTL,
+		Scope:        code.Scopes,
+	}, nil
+}
+
+// refresh rotates the client's refresh token. The new tokens keep the scopes of the
+// old ones, narrowing them down with the scope parameter is not supported.
+func (s *Service) refresh(ctx context.Context, client *models.OAuthClient, req TokenRequest, from models.Client) (*Token, error) {
+	if req.RefreshToken == "" {
+		return nil, ErrInvalidRequest
+	}
+
+	accessToken, refreshToken, err := s.auth.RefreshGrant(ctx, req.RefreshToken, client.ID, from)
+	if err != nil {
+		return nil, grantError(err)
+	}
+
+	return &Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.tokenCfg.JWT.TTL,
+	}, nil
+}
+
+// clientCredentials issues an access token to the client acting on its own behalf
+func (s *Service) clientCredentials(client *models.OAuthClient, req TokenRequest) (*Token, error) {
+	scopes, err := requestedScopes(req.Scope, client)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := jwt.NewClientAccessToken(client.ID, scopes, s.tokenCfg, s.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		AccessToken: accessToken,
+		ExpiresIn:   s.tokenCfg.JWT.TTL,
+		Scope:       scopes,
+	}, nil
+}
@@ -0,0 +1,234 @@
+package serviceaccount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/secret"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+)
+
+var (
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrServiceAccountExists   = errors.New("service account already exists")
+	ErrGroupNotFound          = errors.New("group not found")
+	ErrInvalidName            = errors.New("invalid service account name")
+	ErrInvalidRole            = errors.New("invalid role")
+	ErrInvalidPublicKey       = errors.New("invalid public key")
+)
+
+const (
+	// idSize is the number of random bytes in a service account id
+	idSize = 16
+	// secretSize is the number of random bytes in a service account secret
+	secretSize = 32
+	// maxNameLength is the longest service account name
+	maxNameLength = 255
+)
+
+type Storage interface {
+	CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error
+	ServiceAccount(ctx context.Context, id string) (*models.ServiceAccount, error)
+	ServiceAccounts(ctx context.Context) ([]models.ServiceAccount, error)
+	SetServiceAccountSecret(ctx context.Context, id string, secretHash []byte) error
+	DeleteServiceAccount(ctx context.Context, id string) error
+}
+
+type Cash interface {
+	RevokeUserTokens(ctx context.Context, uuid string, ttl time.Duration) error
+}
+
+type Service struct {
+	log       *slog.Logger
+	storage   Storage
+	cash      Cash
+	tokenCfg  config.Token
+	deadlines config.Deadlines
+}
+
+func New(log *slog.Logger, storage Storage, cash Cash, token config.Token, deadlines config.Deadlines) *Service {
+	return &Service{
+		log:       log,
+		storage:   storage,
+		cash:      cash,
+		tokenCfg:  token,
+		deadlines: deadlines,
+	}
+}
+
+// withDeadline bounds ctx by the deadline of the operation op
+func (s *Service) withDeadline(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.deadlines.For(op))
+}
+
+// Registration describes a new service account. Without a public key
+// to verify its assertions with, the account gets a client secret.
+type Registration struct {
+	Name         string
+	Description  string
+	Role         string
+	OwnerGroupID string
+	PublicKey    string
+}
+
+// Create creates a service account on behalf of the admin createdBy.
+// The secret, if any, is only returned here.
+func (s *Service) Create(ctx context.Context, reg Registration, createdBy string) (*models.ServiceAccount, string, error) {
+	const op = "service.serviceaccount.Create"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	account := &models.ServiceAccount{
+		Name:         strings.TrimSpace(reg.Name),
+		Description:  strings.TrimSpace(reg.Description),
+		Role:         reg.Role,
+		OwnerGroupID: reg.OwnerGroupID,
+		CreatedBy:    createdBy,
+		PublicKey:    strings.TrimSpace(reg.PublicKey),
+	}
+	if account.Role == "" {
+		account.Role = models.RoleUser
+	}
+
+	if account.Name == "" || len(account.Name) > maxNameLength {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidName)
+	}
+	if !validRole(account.Role) {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidRole)
+	}
+	if account.PublicKey != "" {
+		if _, _, err := jwt.ParsePublicKey(account.PublicKey); err != nil {
+			return nil, "", fmt.Errorf("%s: %w: %w", op, ErrInvalidPublicKey, err)
+		}
+	}
+
+	id, err := secret.New(idSize)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	account.ID = models.ServiceAccountIDPrefix + id
+
+	// Only the hash is stored, the secret is handed to whoever creates the account
+	var accountSecret string
+	if account.PublicKey == "" {
+		accountSecret, err = secret.New(secretSize)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		account.SecretHash = secret.Hash(accountSecret)
+	}
+
+	err = s.storage.CreateServiceAccount(ctx, account)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrServiceAccountExists):
+			return nil, "", fmt.Errorf("%s: %w", op, ErrServiceAccountExists)
+		case errors.Is(err, storage.ErrGroupNotFound):
+			return nil, "", fmt.Errorf("%s: %w", op, ErrGroupNotFound)
+		}
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.Info("service account created",
+		slog.String("id", account.ID),
+		slog.String("role", account.Role),
+		slog.String("created_by", createdBy),
+	)
+
+	return account, accountSecret, nil
+}
+
+func (s *Service) ServiceAccount(ctx context.Context, id string) (*models.ServiceAccount, error) {
+	const op = "service.serviceaccount.ServiceAccount"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	account, err := s.storage.ServiceAccount(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrServiceAccountNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return account, nil
+}
+
+func (s *Service) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	const op = "service.serviceaccount.List"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	accounts, err := s.storage.ServiceAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accounts, nil
+}
+
+// RotateSecret gives the service account a new secret, the old one stops working.
+// Tokens issued with the old one are revoked, in case it leaked.
+func (s *Service) RotateSecret(ctx context.Context, id string) (string, error) {
+	const op = "service.serviceaccount.RotateSecret"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	accountSecret, err := secret.New(secretSize)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.storage.SetServiceAccountSecret(ctx, id, secret.Hash(accountSecret))
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrServiceAccountNotFound)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.cash.RevokeUserTokens(ctx, id, s.tokenCfg.JWT.TTL)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accountSecret, nil
+}
+
+// Delete deletes the service account and revokes its tokens
+func (s *Service) Delete(ctx context.Context, id string) error {
+	const op = "service.serviceaccount.Delete"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	err := s.storage.DeleteServiceAccount(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrServiceAccountNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.cash.RevokeUserTokens(ctx, id, s.tokenCfg.JWT.TTL)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func validRole(role string) bool {
+	return role == models.RoleUser || role == models.RoleModerator || role == models.RoleAdmin
+}
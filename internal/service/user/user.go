@@ -5,37 +5,85 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
+	"user-management-service/internal/config"
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/lib/logger"
+	"user-management-service/internal/lib/rbac"
 	"user-management-service/internal/models"
 	"user-management-service/internal/storage"
 )
 
 var (
 	ErrUserNotFound     = errors.New("user not found")
+	ErrUserExists       = errors.New("user already exists")
 	ErrNoFieldsToUpdate = errors.New("no fields to update")
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrInvalidFilter    = errors.New("invalid filter")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrUserBlocked      = errors.New("user is blocked")
+	ErrCannotBlockSelf  = errors.New("users can't block themselves")
+	ErrInvalidBlockEnd  = errors.New("block must end in the future")
+	ErrOutranked        = errors.New("user's role is not below yours")
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 100
 )
 
 type Storage interface {
 	UserByUUID(ctx context.Context, uuid string) (*models.User, error)
+	UserByName(ctx context.Context, username string) (*models.User, error)
 	PatchUser(ctx context.Context, uuid string, user *models.User) (*models.User, error)
+	ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, string, error)
+	UpdateUser(ctx context.Context, uuid string, patch models.UserPatch) (*models.User, error)
+	BlockUser(ctx context.Context, uuid, blockedBy, reason string, until *time.Time) (*models.User, error)
+	UnblockUser(ctx context.Context, uuid string) (*models.User, error)
+	RevokeSessions(ctx context.Context, uuid string) ([]models.Session, error)
 	Delete(ctx context.Context, uuid string) error
 }
+
+type Cash interface {
+	RevokeTokens(ctx context.Context, tokens map[string]time.Duration) error
+	RevokeUserTokens(ctx context.Context, uuid string, ttl time.Duration) error
+	UnlockAccount(ctx context.Context, username string) error
+}
+
 type Service struct {
-	log     *slog.Logger
-	storage Storage
+	log       *slog.Logger
+	storage   Storage
+	cash      Cash
+	tokenCfg  config.Token
+	deadlines config.Deadlines
 }
 
-func New(log *slog.Logger, storage Storage) *Service {
+func New(log *slog.Logger, storage Storage, cash Cash, token config.Token, deadlines config.Deadlines) *Service {
 	return &Service{
-		log:     log,
-		storage: storage,
+		log:       log,
+		storage:   storage,
+		cash:      cash,
+		tokenCfg:  token,
+		deadlines: deadlines,
 	}
 }
 
-func (s *Service) UserByUUID(uuid string) (*models.User, error) {
+// withDeadline bounds ctx by the deadline of the operation op
+func (s *Service) withDeadline(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.deadlines.For(op))
+}
+
+// detached keeps the values of ctx but not its cancellation, for work that must be
+// done once started even if the moderator goes away, bounded by the deadline of op
+func (s *Service) detached(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), s.deadlines.For(op))
+}
+
+func (s *Service) UserByUUID(ctx context.Context, uuid string) (*models.User, error) {
 	const op = "service.user.UserByUUID"
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := s.withDeadline(ctx, op)
 	defer cancel()
 
 	user, err := s.storage.UserByUUID(ctx, uuid)
@@ -49,10 +97,10 @@ func (s *Service) UserByUUID(uuid string) (*models.User, error) {
 	return user, nil
 }
 
-func (s *Service) PatchUser(uuid string, user *models.User) (*models.User, error) {
+func (s *Service) PatchUser(ctx context.Context, uuid string, user *models.User) (*models.User, error) {
 	const op = "service.user.PatchUser"
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := s.withDeadline(ctx, op)
 	defer cancel()
 
 	info, err := s.storage.PatchUser(ctx, uuid, user)
@@ -66,16 +114,264 @@ func (s *Service) PatchUser(uuid string, user *models.User) (*models.User, error
 	return info, nil
 }
 
-func (s *Service) Delete(uuid string) error {
+func (s *Service) Delete(ctx context.Context, uuid string) error {
 	const op = "service.user.Delete"
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := s.withDeadline(ctx, op)
 	defer cancel()
 
 	err := s.storage.Delete(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Sessions go away with the user, the access tokens issued to them don't
+	err = s.revokeTokens(ctx, uuid)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
+
+// ListUsers returns a page of users matching filter and the cursor of the next page
+func (s *Service) ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, string, error) {
+	const op = "service.user.ListUsers"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	if filter.Sort == "" {
+		filter.Sort = "created_at"
+	}
+	if filter.Order == "" {
+		filter.Order = "asc"
+	}
+	if filter.Sort != "created_at" && filter.Sort != "username" && filter.Sort != "email" {
+		return nil, "", fmt.Errorf("%s: sort %q: %w", op, filter.Sort, ErrInvalidFilter)
+	}
+	if filter.Order != "asc" && filter.Order != "desc" {
+		return nil, "", fmt.Errorf("%s: order %q: %w", op, filter.Order, ErrInvalidFilter)
+	}
+	if filter.Role != "" && !validRole(filter.Role) {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidRole)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	filter.Limit = min(filter.Limit, maxListLimit)
+
+	users, next, err := s.storage.ListUsers(ctx, filter)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidCursor)
+		}
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, next, nil
+}
+
+// UpdateUser changes any field of a user, including the ones users can't change themselves.
+// A new role revokes the user's tokens, which carry the old one.
+func (s *Service) UpdateUser(ctx context.Context, uuid string, patch models.UserPatch) (*models.User, error) {
+	const op = "service.user.UpdateUser"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	var roleChanged bool
+	if patch.Role != nil {
+		if !validRole(*patch.Role) {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidRole)
+		}
+
+		current, err := s.storage.UserByUUID(ctx, uuid)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+			}
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		roleChanged = current.Role != *patch.Role
+	}
+
+	if patch.Username != nil {
+		u, err := s.storage.UserByName(ctx, *patch.Username)
+		if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if u != nil && u.UUID != uuid {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserExists)
+		}
+	}
+
+	user, err := s.storage.UpdateUser(ctx, uuid, patch)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		if errors.Is(err, storage.ErrNoFieldsToUpdate) {
+			return nil, fmt.Errorf("%s: %w", op, ErrNoFieldsToUpdate)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// A demoted user must not keep the privileges of the old role until their tokens expire
+	if roleChanged {
+		err = s.revokeTokens(ctx, uuid)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return user, nil
+}
+
+// Block blocks the user on behalf of moderator, whose role has to be above the user's,
+// until the given time, or for good if until is nil, and revokes every token the user holds
+func (s *Service) Block(ctx context.Context, uuid, moderator, role, reason string, until *time.Time) (*models.User, error) {
+	const op = "service.user.Block"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	if uuid == moderator {
+		return nil, fmt.Errorf("%s: %w", op, ErrCannotBlockSelf)
+	}
+	if until != nil && !until.After(time.Now()) {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidBlockEnd)
+	}
+
+	_, err := s.userBelow(ctx, uuid, role)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := s.storage.BlockUser(ctx, uuid, moderator, reason, until)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.revokeTokens(ctx, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.FromContext(ctx, s.log).Info("user blocked",
+		slog.String("uuid", uuid),
+		slog.String("moderator", moderator),
+		slog.String("reason", reason),
+	)
+
+	return user, nil
+}
+
+// Unblock lifts the user's block on behalf of a moderator of role, which has to be above
+// the user's and not below the one of whoever set the block
+func (s *Service) Unblock(ctx context.Context, uuid, role string) (*models.User, error) {
+	const op = "service.user.Unblock"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	target, err := s.userBelow(ctx, uuid, role)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if target.BlockedBy != "" {
+		blocker, err := s.storage.UserByUUID(ctx, target.BlockedBy)
+		if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if blocker != nil && rbac.Outranks(blocker.Role, role) {
+			return nil, fmt.Errorf("%s: %w", op, ErrOutranked)
+		}
+	}
+
+	user, err := s.storage.UnblockUser(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// Unlock lifts the lockout failed logins put on the user and forgets the failures,
+// on behalf of a moderator of role, which has to be above the user's
+func (s *Service) Unlock(ctx context.Context, uuid, role string) (*models.User, error) {
+	const op = "service.user.Unlock"
+
+	ctx, cancel := s.withDeadline(ctx, op)
+	defer cancel()
+
+	user, err := s.userBelow(ctx, uuid, role)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.cash.UnlockAccount(ctx, user.Username)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// ActiveUser returns the user unless they are blocked
+func (s *Service) ActiveUser(ctx context.Context, uuid string) (*models.User, error) {
+	const op = "service.user.ActiveUser"
+
+	user, err := s.UserByUUID(ctx, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.Blocked(time.Now()) {
+		return nil, fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	return user, nil
+}
+
+// userBelow returns the user, failing with ErrOutranked unless role is above theirs
+func (s *Service) userBelow(ctx context.Context, uuid, role string) (*models.User, error) {
+	user, err := s.storage.UserByUUID(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if !rbac.Outranks(role, user.Role) {
+		return nil, ErrOutranked
+	}
+
+	return user, nil
+}
+
+// revokeTokens ends the user's sessions and invalidates every token issued to them so far
+func (s *Service) revokeTokens(ctx context.Context, uuid string) error {
+	const op = "service.user.revokeTokens"
+
+	// The user is blocked, demoted or deleted by now, their tokens must not outlive the caller going away
+	ctx, cancel := s.detached(ctx, op)
+	defer cancel()
+
+	return jwt.EndSessions(ctx, s.storage, s.cash, uuid, s.tokenCfg)
+}
+
+func validRole(role string) bool {
+	return role == models.RoleUser || role == models.RoleModerator || role == models.RoleAdmin
+}
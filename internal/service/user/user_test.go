@@ -0,0 +1,117 @@
+package user
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"user-management-service/internal/config"
+	"user-management-service/internal/lib/jwt"
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+// memoryStorage keeps users and their sessions in memory, mimicking storage.postgres.
+// Methods the tests don't need panic through the nil Storage.
+type memoryStorage struct {
+	Storage
+	users    map[string]bool
+	sessions map[string][]models.Session
+}
+
+func (m *memoryStorage) Delete(_ context.Context, uuid string) error {
+	if !m.users[uuid] {
+		return storage.ErrUserNotFound
+	}
+	// Sessions are deleted along with their user
+	delete(m.users, uuid)
+	delete(m.sessions, uuid)
+
+	return nil
+}
+
+func (m *memoryStorage) RevokeSessions(_ context.Context, uuid string) ([]models.Session, error) {
+	sessions := m.sessions[uuid]
+	delete(m.sessions, uuid)
+
+	return sessions, nil
+}
+
+// memoryCash is a denylist in memory, mimicking cache.redis.
+// Methods the tests don't need panic through the nil Cash.
+type memoryCash struct {
+	Cash
+	tokens        map[string]bool
+	revokedBefore map[string]time.Time
+}
+
+func (c *memoryCash) RevokeTokens(_ context.Context, tokens map[string]time.Duration) error {
+	for id := range tokens {
+		c.tokens[id] = true
+	}
+	return nil
+}
+
+func (c *memoryCash) RevokeUserTokens(_ context.Context, uuid string, _ time.Duration) error {
+	c.revokedBefore[uuid] = time.Now()
+	return nil
+}
+
+func (c *memoryCash) IsTokenRevoked(_ context.Context, id string) (bool, error) {
+	return c.tokens[id], nil
+}
+
+func (c *memoryCash) IsSessionRevoked(_ context.Context, _ string) (bool, error) {
+	return false, nil
+}
+
+func (c *memoryCash) UserTokensRevokedAt(_ context.Context, uuid string) (time.Time, error) {
+	return c.revokedBefore[uuid], nil
+}
+
+func TestDeleteRevokesTokens(t *testing.T) {
+	ctx := context.Background()
+	uuid := "0d5ba1c8-3b2f-4d6e-9a55-0f0c8c3f7a10"
+
+	store := &memoryStorage{
+		users:    map[string]bool{uuid: true},
+		sessions: map[string][]models.Session{uuid: {{ID: "session", UserUUID: uuid, RefreshJTI: "refresh", ExpiresAt: time.Now().Add(time.Hour)}}},
+	}
+	cash := &memoryCash{tokens: map[string]bool{}, revokedBefore: map[string]time.Time{}}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := New(log, store, cash, config.Token{}, config.Deadlines{OperationTimeout: time.Second})
+
+	// An admin's access token, checked by the auth middleware without looking the user up
+	claims := gojwt.MapClaims{
+		"sub":  uuid,
+		"typ":  jwt.TypeAccess,
+		"jti":  "access",
+		"sid":  "session",
+		"role": models.RoleAdmin,
+		"iat":  float64(time.Now().Add(-time.Minute).Unix()),
+	}
+
+	revoked, err := jwt.Revoked(ctx, cash, uuid, claims)
+	if err != nil {
+		t.Fatalf("Revoked() error = %v", err)
+	}
+	if revoked {
+		t.Fatal("access token is revoked before the user is deleted")
+	}
+
+	if err := s.Delete(ctx, uuid); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	revoked, err = jwt.Revoked(ctx, cash, uuid, claims)
+	if err != nil {
+		t.Fatalf("Revoked() error = %v", err)
+	}
+	if !revoked {
+		t.Error("access token of a deleted user is not revoked")
+	}
+}
@@ -0,0 +1,295 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+func (s *Storage) CreateGroup(ctx context.Context, name, description string) (*models.Group, error) {
+	const op = "storage.postgres.CreateGroup"
+
+	var g models.Group
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO groups (name, description) VALUES ($1, $2)
+		RETURNING id, name, description, created_at`, name, description,
+	).Scan(&g.ID, &g.Name, &g.Description, &g.CreatedAt)
+	if err != nil {
+		if isViolation(err, uniqueViolation) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrGroupExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &g, nil
+}
+
+func (s *Storage) Group(ctx context.Context, id string) (*models.Group, error) {
+	const op = "storage.postgres.Group"
+
+	var g models.Group
+	err := s.db.QueryRow(ctx, `
+		SELECT id, name, description, created_at FROM groups WHERE id=$1`, id,
+	).Scan(&g.ID, &g.Name, &g.Description, &g.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrGroupNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &g, nil
+}
+
+// Groups returns a page of groups ordered by name, only the ones member belongs to
+// if it is not empty, along with the cursor of the next page.
+func (s *Storage) Groups(ctx context.Context, member string, limit int, cursor string) ([]models.Group, string, error) {
+	const op = "storage.postgres.Groups"
+
+	var args []interface{}
+	var conds []string
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if member != "" {
+		conds = append(conds, "id IN (SELECT group_id FROM users_groups WHERE user_id="+arg(member)+")")
+	}
+	if cursor != "" {
+		cur, err := decodeCursor(cursor)
+		if err != nil || cur.Sort != "name" {
+			return nil, "", fmt.Errorf("%s: %w", op, storage.ErrInvalidCursor)
+		}
+		conds = append(conds, "name > "+arg(cur.Value))
+	}
+
+	query := "SELECT id, name, description, created_at FROM groups"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY name LIMIT " + arg(limit+1)
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var groups []models.Group
+	for rows.Next() {
+		var g models.Group
+		if err := rows.Scan(&g.ID, &g.Name, &g.Description, &g.CreatedAt); err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(groups) <= limit {
+		return groups, "", nil
+	}
+	groups = groups[:limit]
+
+	next, err := encodeCursor(pageCursor{Sort: "name", Value: groups[len(groups)-1].Name})
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return groups, next, nil
+}
+
+// GroupNames returns the names of the groups the user belongs to.
+func (s *Storage) GroupNames(ctx context.Context, uuid string) ([]string, error) {
+	const op = "storage.postgres.GroupNames"
+
+	rows, err := s.db.Query(ctx, `
+		SELECT g.name
+		FROM groups g
+		JOIN users_groups ug ON g.id = ug.group_id
+		WHERE ug.user_id = $1
+		ORDER BY g.name`, uuid,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return names, nil
+}
+
+func (s *Storage) UpdateGroup(ctx context.Context, id string, patch models.GroupPatch) (*models.Group, error) {
+	const op = "storage.postgres.UpdateGroup"
+
+	var args []interface{}
+	var attrs []string
+	set := func(column string, v interface{}) {
+		args = append(args, v)
+		attrs = append(attrs, column+"=$"+strconv.Itoa(len(args)))
+	}
+
+	if patch.Name != nil {
+		set("name", *patch.Name)
+	}
+	if patch.Description != nil {
+		set("description", *patch.Description)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrNoFieldsToUpdate)
+	}
+
+	args = append(args, id)
+
+	query := "UPDATE groups SET " + strings.Join(attrs, ", ") + " WHERE id=$" + strconv.Itoa(len(args)) + " RETURNING id, name, description, created_at"
+
+	var g models.Group
+	err := s.db.QueryRow(ctx, query, args...).Scan(&g.ID, &g.Name, &g.Description, &g.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrGroupNotFound)
+		}
+		if isViolation(err, uniqueViolation) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrGroupExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &g, nil
+}
+
+// DeleteGroup removes the group, its memberships go along.
+func (s *Storage) DeleteGroup(ctx context.Context, id string) error {
+	const op = "storage.postgres.DeleteGroup"
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM groups WHERE id=$1`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrGroupNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) AddGroupMember(ctx context.Context, groupID, uuid string) error {
+	const op = "storage.postgres.AddGroupMember"
+
+	_, err := s.db.Exec(ctx, `INSERT INTO users_groups (user_id, group_id) VALUES ($1, $2)`, uuid, groupID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch {
+			case pgErr.Code == uniqueViolation:
+				return fmt.Errorf("%s: %w", op, storage.ErrAlreadyMember)
+			case pgErr.Code == foreignKeyViolation && pgErr.ConstraintName == "users_groups_group_id_fkey":
+				return fmt.Errorf("%s: %w", op, storage.ErrGroupNotFound)
+			case pgErr.Code == foreignKeyViolation:
+				return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+			}
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RemoveGroupMember(ctx context.Context, groupID, uuid string) error {
+	const op = "storage.postgres.RemoveGroupMember"
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM users_groups WHERE group_id=$1 AND user_id=$2`, groupID, uuid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrNotMember)
+	}
+
+	return nil
+}
+
+// GroupMembers returns a page of the group's members ordered by username,
+// along with the cursor of the next page.
+func (s *Storage) GroupMembers(ctx context.Context, groupID string, limit int, cursor string) ([]models.User, string, error) {
+	const op = "storage.postgres.GroupMembers"
+
+	// Tell an empty group from a missing one
+	var exists bool
+	err := s.db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM groups WHERE id=$1)`, groupID).Scan(&exists)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return nil, "", fmt.Errorf("%s: %w", op, storage.ErrGroupNotFound)
+	}
+
+	args := []interface{}{groupID}
+	query := "SELECT " + userColumns + " FROM users WHERE id IN (SELECT user_id FROM users_groups WHERE group_id=$1)"
+
+	if cursor != "" {
+		cur, err := decodeCursor(cursor)
+		if err != nil || cur.Sort != "username" {
+			return nil, "", fmt.Errorf("%s: %w", op, storage.ErrInvalidCursor)
+		}
+		args = append(args, cur.Value, cur.UUID)
+		query += " AND (username, id) > ($2, $3::uuid)"
+	}
+
+	args = append(args, limit+1)
+	query += " ORDER BY username, id LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(users) <= limit {
+		return users, "", nil
+	}
+	users = users[:limit]
+
+	last := users[len(users)-1]
+	next, err := encodeCursor(pageCursor{Sort: "username", Value: last.Username, UUID: last.UUID})
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, next, nil
+}
+
+func isViolation(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
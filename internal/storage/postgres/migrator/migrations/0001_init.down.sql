@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS update_users_modified_at ON users;
+
+DROP FUNCTION IF EXISTS update_modified_at();
+
+DROP TABLE IF EXISTS users_groups;
+
+DROP TABLE IF EXISTS groups;
+
+DROP TABLE IF EXISTS users;
+
+DROP TYPE IF EXISTS ROLE;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret VARCHAR(255) NOT NULL,
+	confirmed_at TIMESTAMP WITH TIME ZONE,
+	last_used_step BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+	id BIGSERIAL PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash BYTEA NOT NULL,
+	used_at TIMESTAMP WITH TIME ZONE,
+	UNIQUE (user_id, code_hash)
+);
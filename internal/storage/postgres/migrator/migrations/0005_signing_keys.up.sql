@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS signing_keys (
+	kid VARCHAR(64) PRIMARY KEY,
+	algorithm VARCHAR(16) NOT NULL,
+	private_key BYTEA NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	retired_at TIMESTAMP WITH TIME ZONE,
+	expires_at TIMESTAMP WITH TIME ZONE
+);
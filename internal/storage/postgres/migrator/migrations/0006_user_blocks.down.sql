@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_by;
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_until;
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_at;
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_reason;
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS users_groups_group_id_idx;
+
+ALTER TABLE users_groups DROP CONSTRAINT IF EXISTS users_groups_user_id_group_id_key;
+ALTER TABLE users_groups DROP CONSTRAINT IF EXISTS users_groups_group_id_fkey;
+ALTER TABLE users_groups DROP CONSTRAINT IF EXISTS users_groups_user_id_fkey;
+ALTER TABLE users_groups
+	ADD CONSTRAINT users_groups_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id),
+	ADD CONSTRAINT users_groups_group_id_fkey FOREIGN KEY (group_id) REFERENCES groups(id);
+
+ALTER TABLE groups DROP CONSTRAINT IF EXISTS groups_name_key;
+ALTER TABLE groups DROP COLUMN IF EXISTS description;
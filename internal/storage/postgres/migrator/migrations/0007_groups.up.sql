@@ -0,0 +1,19 @@
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE groups DROP CONSTRAINT IF EXISTS groups_name_key;
+ALTER TABLE groups ADD CONSTRAINT groups_name_key UNIQUE (name);
+
+-- A user is in a group once, duplicates are dropped before that is enforced
+DELETE FROM users_groups a USING users_groups b
+WHERE a.user_id = b.user_id AND a.group_id = b.group_id AND a.id > b.id;
+
+ALTER TABLE users_groups DROP CONSTRAINT IF EXISTS users_groups_user_id_fkey;
+ALTER TABLE users_groups DROP CONSTRAINT IF EXISTS users_groups_group_id_fkey;
+ALTER TABLE users_groups DROP CONSTRAINT IF EXISTS users_groups_user_id_group_id_key;
+-- Memberships go away together with their user or group
+ALTER TABLE users_groups
+	ADD CONSTRAINT users_groups_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	ADD CONSTRAINT users_groups_group_id_fkey FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+	ADD CONSTRAINT users_groups_user_id_group_id_key UNIQUE (user_id, group_id);
+
+CREATE INDEX IF NOT EXISTS users_groups_group_id_idx ON users_groups (group_id);
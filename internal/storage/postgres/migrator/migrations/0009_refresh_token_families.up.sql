@@ -0,0 +1,2 @@
+-- Every session is a refresh token family, only its latest token may be used
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS refresh_jti VARCHAR(64);
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS oauth_clients (
+	id VARCHAR(64) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	secret_hash BYTEA,
+	redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+	grant_types TEXT[] NOT NULL DEFAULT '{}',
+	scopes TEXT[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+	code_hash BYTEA PRIMARY KEY,
+	client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	redirect_uri TEXT NOT NULL DEFAULT '',
+	scopes TEXT[] NOT NULL DEFAULT '{}',
+	code_challenge VARCHAR(128) NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS oauth_authorization_codes_user_id_idx ON oauth_authorization_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS oauth_consents (
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	scopes TEXT[] NOT NULL DEFAULT '{}',
+	granted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, client_id)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS service_accounts (
+	id VARCHAR(64) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT '',
+	role VARCHAR(64) NOT NULL,
+	owner_group_id UUID REFERENCES groups(id) ON DELETE SET NULL,
+	created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	secret_hash BYTEA,
+	public_key TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
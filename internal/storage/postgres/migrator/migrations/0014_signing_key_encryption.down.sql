@@ -0,0 +1,3 @@
+-- Sealed keys are of no use without the column telling them apart
+DELETE FROM signing_keys WHERE encrypted;
+ALTER TABLE signing_keys DROP COLUMN IF EXISTS encrypted;
@@ -0,0 +1,3 @@
+-- Private keys are sealed with JWT_KEY_ENCRYPTION_KEY from now on, the ones stored
+-- in plaintext before are retired on the next start and dropped once expired
+ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS encrypted BOOLEAN NOT NULL DEFAULT FALSE;
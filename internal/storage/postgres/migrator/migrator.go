@@ -0,0 +1,372 @@
+package migrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+// lockID is the key of the advisory lock held while migrations are applied,
+// so that replicas starting at the same time don't race each other.
+const lockID int64 = 7311520465193172801
+
+var (
+	ErrSchemaOutdated   = errors.New("database schema is behind the binary")
+	ErrChecksumMismatch = errors.New("applied migration differs from the embedded one")
+	ErrUnknownMigration = errors.New("applied migration is unknown to the binary")
+	ErrNoDownMigration  = errors.New("migration has no down script")
+	ErrInvalidFileName  = errors.New("invalid migration file name")
+)
+
+var fileNameRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+func New(db *pgxpool.Pool) (*Migrator, error) {
+	const op = "storage.postgres.migrator.New"
+
+	sub, err := fs.Sub(embedded, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	migrations, err := Load(sub)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Load reads NNNN_name.up.sql / NNNN_name.down.sql pairs from the root of fsys
+// and returns them ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	const op = "storage.postgres.migrator.Load"
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		parts := fileNameRe.FindStringSubmatch(e.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("%s: %s: %w", op, e.Name(), ErrInvalidFileName)
+		}
+
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", op, e.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[2] {
+			return nil, fmt.Errorf("%s: version %d has conflicting names %q and %q", op, version, m.Name, parts[2])
+		}
+
+		switch parts[3] {
+		case "up":
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		case "down":
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%s: version %d has no up script", op, m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies every pending migration and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	const op = "storage.postgres.migrator.Up"
+
+	var done []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+
+				_, err := tx.Exec(ctx, `
+					INSERT INTO schema_migrations (version, name, checksum)
+					VALUES ($1, $2, $3)`, mig.Version, mig.Name, mig.Checksum,
+				)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return done, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations and returns the ones it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	const op = "storage.postgres.migrator.Down"
+
+	var done []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		// Never roll back past migrations this binary doesn't know how to revert
+		latest := m.migrations[len(m.migrations)-1].Version
+		for version := range applied {
+			if version > latest {
+				return fmt.Errorf("version %d: %w", version, ErrUnknownMigration)
+			}
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, ErrNoDownMigration)
+			}
+
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Down); err != nil {
+					return err
+				}
+
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version=$1`, mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return done, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return done, nil
+}
+
+// Status lists every embedded migration together with the time it was applied, if it was.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	const op = "storage.postgres.migrator.Status"
+
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Release()
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			st.AppliedAt = &a.appliedAt
+		}
+		res = append(res, st)
+	}
+
+	return res, nil
+}
+
+// Check returns ErrSchemaOutdated if any embedded migration is not applied yet.
+// Migrations applied by a newer binary are tolerated so rolling deploys keep working.
+func (m *Migrator) Check(ctx context.Context) error {
+	const op = "storage.postgres.migrator.Check"
+
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Release()
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, mig := range m.migrations {
+		a, ok := applied[mig.Version]
+		if !ok {
+			return fmt.Errorf("%s: migration %d_%s is pending: %w", op, mig.Version, mig.Name, ErrSchemaOutdated)
+		}
+		if a.checksum != mig.Checksum {
+			return fmt.Errorf("%s: migration %d_%s: %w", op, mig.Version, mig.Name, ErrChecksumMismatch)
+		}
+	}
+
+	return nil
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// Advisory locks are held by the session, so lock and unlock must use the same connection
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// verify makes sure every applied migration known to the binary still matches the embedded one.
+func (m *Migrator) verify(ctx context.Context, conn *pgxpool.Conn) (map[int64]appliedMigration, error) {
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mig := range m.migrations {
+		a, ok := applied[mig.Version]
+		if ok && a.checksum != mig.Checksum {
+			return nil, fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, ErrChecksumMismatch)
+		}
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int64]appliedMigration, error) {
+	var exists bool
+	err := conn.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]appliedMigration)
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := conn.Query(ctx, `SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
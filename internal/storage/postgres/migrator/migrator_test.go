@@ -0,0 +1,84 @@
+package migrator
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		versions []int64
+		wantErr  string
+	}{
+		{
+			name: "ordered by version",
+			fsys: fstest.MapFS{
+				"0002_second.up.sql":   {Data: []byte("SELECT 2;")},
+				"0002_second.down.sql": {Data: []byte("SELECT -2;")},
+				"0001_first.up.sql":    {Data: []byte("SELECT 1;")},
+			},
+			versions: []int64{1, 2},
+		},
+		{
+			name: "invalid file name",
+			fsys: fstest.MapFS{
+				"first.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: ErrInvalidFileName.Error(),
+		},
+		{
+			name: "down without up",
+			fsys: fstest.MapFS{
+				"0001_first.down.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: "version 1 has no up script",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.fsys)
+			if (err != nil) != (tt.wantErr != "") {
+				t.Fatalf("Load() error = %v, wantErr %q", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(got) != len(tt.versions) {
+				t.Fatalf("Load() returned %d migrations, want %d", len(got), len(tt.versions))
+			}
+			for i, m := range got {
+				if m.Version != tt.versions[i] {
+					t.Errorf("Load()[%d].Version = %d, want %d", i, m.Version, tt.versions[i])
+				}
+				if len(m.Checksum) != 64 {
+					t.Errorf("Load()[%d].Checksum = %q, want sha256 hex", i, m.Checksum)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	sub, err := fs.Sub(embedded, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := Load(sub)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
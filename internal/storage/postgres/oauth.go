@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const oauthClientColumns = `id, name, secret_hash, redirect_uris, grant_types, scopes, created_at`
+
+func (s *Storage) CreateOAuthClient(ctx context.Context, client *models.OAuthClient) error {
+	const op = "storage.postgres.CreateOAuthClient"
+
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, grant_types, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at`,
+		client.ID, client.Name, client.SecretHash, client.RedirectURIs, client.GrantTypes, client.Scopes,
+	).Scan(&client.CreatedAt)
+	if err != nil {
+		if isViolation(err, uniqueViolation) {
+			return fmt.Errorf("%s: %w", op, storage.ErrClientExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) OAuthClient(ctx context.Context, id string) (*models.OAuthClient, error) {
+	const op = "storage.postgres.OAuthClient"
+
+	client, err := scanOAuthClient(s.db.QueryRow(ctx, `SELECT `+oauthClientColumns+` FROM oauth_clients WHERE id=$1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrClientNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return client, nil
+}
+
+// OAuthClients returns every registered client, the latest first.
+func (s *Storage) OAuthClients(ctx context.Context) ([]models.OAuthClient, error) {
+	const op = "storage.postgres.OAuthClients"
+
+	rows, err := s.db.Query(ctx, `SELECT `+oauthClientColumns+` FROM oauth_clients ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var clients []models.OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		clients = append(clients, *client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return clients, nil
+}
+
+// DeleteOAuthClient deletes the client along with its authorization codes and consents.
+func (s *Storage) DeleteOAuthClient(ctx context.Context, id string) error {
+	const op = "storage.postgres.DeleteOAuthClient"
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM oauth_clients WHERE id=$1`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrClientNotFound)
+	}
+
+	return nil
+}
+
+// CreateAuthorizationCode stores the code under its hash. The user's expired codes
+// are cleaned up on the way.
+func (s *Storage) CreateAuthorizationCode(ctx context.Context, codeHash []byte, code models.AuthorizationCode) error {
+	const op = "storage.postgres.CreateAuthorizationCode"
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			DELETE FROM oauth_authorization_codes
+			WHERE user_id=$1 AND expires_at <= CURRENT_TIMESTAMP`, code.UserUUID,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, nonce, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			codeHash, code.ClientID, code.UserUUID, code.RedirectURI, code.Scopes, code.CodeChallenge, code.Nonce, code.ExpiresAt,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseAuthorizationCode consumes the unexpired code with codeHash, so that it can't be exchanged twice.
+func (s *Storage) UseAuthorizationCode(ctx context.Context, codeHash []byte) (*models.AuthorizationCode, error) {
+	const op = "storage.postgres.UseAuthorizationCode"
+
+	var code models.AuthorizationCode
+	var valid bool
+	err := s.db.QueryRow(ctx, `
+		DELETE FROM oauth_authorization_codes
+		WHERE code_hash=$1
+		RETURNING client_id, user_id, redirect_uri, scopes, code_challenge, nonce, expires_at,
+			expires_at > CURRENT_TIMESTAMP`, codeHash,
+	).Scan(&code.ClientID, &code.UserUUID, &code.RedirectURI, &code.Scopes, &code.CodeChallenge, &code.Nonce, &code.ExpiresAt, &valid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrCodeNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Deleted all the same, an expired code is of no use anymore
+	if !valid {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrCodeNotFound)
+	}
+
+	return &code, nil
+}
+
+func (s *Storage) Consent(ctx context.Context, uuid, clientID string) (*models.Consent, error) {
+	const op = "storage.postgres.Consent"
+
+	consent := models.Consent{UserUUID: uuid, ClientID: clientID}
+	err := s.db.QueryRow(ctx, `
+		SELECT scopes, granted_at FROM oauth_consents
+		WHERE user_id=$1 AND client_id=$2`, uuid, clientID,
+	).Scan(&consent.Scopes, &consent.GrantedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrConsentNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &consent, nil
+}
+
+// SaveConsent records that the user allowed the client scopes, replacing what was allowed before.
+func (s *Storage) SaveConsent(ctx context.Context, uuid, clientID string, scopes []string) error {
+	const op = "storage.postgres.SaveConsent"
+
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO oauth_consents (user_id, client_id, scopes) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET
+			scopes=EXCLUDED.scopes,
+			granted_at=CURRENT_TIMESTAMP`, uuid, clientID, scopes,
+	)
+	if err != nil {
+		if isViolation(err, foreignKeyViolation) {
+			return fmt.Errorf("%s: %w", op, storage.ErrClientNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func scanOAuthClient(row pgx.Row) (*models.OAuthClient, error) {
+	var c models.OAuthClient
+	err := row.Scan(&c.ID, &c.Name, &c.SecretHash, &c.RedirectURIs, &c.GrantTypes, &c.Scopes, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.Public = c.SecretHash == nil
+
+	return &c, nil
+}
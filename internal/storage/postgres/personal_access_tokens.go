@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreatePersonalAccessToken stores the token with tokenHash, filling in its id and creation time.
+func (s *Storage) CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken, tokenHash []byte) error {
+	const op = "storage.postgres.CreatePersonalAccessToken"
+
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO personal_access_tokens (user_id, name, prefix, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		token.UserUUID, token.Name, token.Prefix, tokenHash, token.Scopes, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PersonalAccessTokens returns the user's tokens, expired ones included, newest first.
+func (s *Storage) PersonalAccessTokens(ctx context.Context, uuid string) ([]models.PersonalAccessToken, error) {
+	const op = "storage.postgres.PersonalAccessTokens"
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE user_id=$1
+		ORDER BY created_at DESC`, uuid,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var tokens []models.PersonalAccessToken
+	for rows.Next() {
+		token, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		tokens = append(tokens, *token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// PersonalAccessToken returns the token with tokenHash.
+func (s *Storage) PersonalAccessToken(ctx context.Context, tokenHash []byte) (*models.PersonalAccessToken, error) {
+	const op = "storage.postgres.PersonalAccessToken"
+
+	token, err := scanPersonalAccessToken(s.db.QueryRow(ctx, `
+		SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE token_hash=$1`, tokenHash,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrPersonalTokenNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+// TouchPersonalAccessToken records that the token with id was just used.
+func (s *Storage) TouchPersonalAccessToken(ctx context.Context, id string) error {
+	const op = "storage.postgres.TouchPersonalAccessToken"
+
+	_, err := s.db.Exec(ctx, `UPDATE personal_access_tokens SET last_used_at=CURRENT_TIMESTAMP WHERE id=$1`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeletePersonalAccessToken deletes the user's token with id.
+func (s *Storage) DeletePersonalAccessToken(ctx context.Context, uuid, id string) error {
+	const op = "storage.postgres.DeletePersonalAccessToken"
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM personal_access_tokens WHERE id=$1 AND user_id=$2`, id, uuid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrPersonalTokenNotFound)
+	}
+
+	return nil
+}
+
+func scanPersonalAccessToken(row pgx.Row) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	err := row.Scan(
+		&token.ID, &token.UserUUID, &token.Name, &token.Prefix, &token.Scopes,
+		&token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
@@ -2,7 +2,8 @@ package postgres
 
 import (
 	"context"
-	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
@@ -12,6 +13,7 @@ import (
 	"user-management-service/internal/config"
 	"user-management-service/internal/models"
 	"user-management-service/internal/storage"
+	"user-management-service/internal/storage/postgres/migrator"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -41,55 +43,18 @@ func New(cfg config.Storage) (*Storage, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	db.Exec(context.TODO(), `
-	CREATE TYPE ROLE AS ENUM ('user', 'moderator', 'admin');
-	
-	CREATE TABLE IF NOT EXISTS users (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		name VARCHAR(255) DEFAULT '',
-		surname VARCHAR(255) DEFAULT '',
-		username VARCHAR(255) NOT NULL,
-		pass_hash BYTEA NOT NULL,
-		phone_number VARCHAR(255) DEFAULT '',
-		email VARCHAR(255) NOT NULL,
-		role ROLE DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
-		image_s3_path VARCHAR(255) DEFAULT '',
-		is_blocked BOOLEAN DEFAULT false,
-		created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-		modified_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS groups (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		name VARCHAR(255) NOT NULL,
-		created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS users_groups (
-		id BISERIAL PRIMARY KEY,
-		user_id UUID NOT NULL,
-		group_id UUID NOT NULL,
-		FOREIGN KEY (user_id) REFERENCES users(id),
-		FOREIGN KEY (group_id) REFERENCES groups(id)
-	);
-
-	CREATE OR REPLACE FUNCTION update_modified_at()
-	RETURNS TRIGGER AS $$
-	BEGIN
-		NEW.modified_at = CURRENT_TIMESTAMP;
-		RETURN NEW;
-	END;
-	$$ LANGUAGE plpgsql;
-
-	CREATE TRIGGER update_users_modified_at
-	BEFORE UPDATE ON users
-	FOR EACH ROW
-	EXECUTE FUNCTION update_modified_at();
-	`)
-
 	return &Storage{db: db}, nil
 }
 
+func (s *Storage) Close() {
+	s.db.Close()
+}
+
+// Migrator returns the schema migrator bound to the storage connection pool.
+func (s *Storage) Migrator() (*migrator.Migrator, error) {
+	return migrator.New(s.db)
+}
+
 func (s *Storage) UserByUUID(ctx context.Context, uuid string) (*models.User, error) {
 	const op = "storage.postgres.UserByUUID"
 
@@ -98,6 +63,7 @@ func (s *Storage) UserByUUID(ctx context.Context, uuid string) (*models.User, er
 	// Fetch the user information
 	userRow := s.db.QueryRow(ctx, `
         SELECT
+            u.id,
             u.name,
             u.surname,
             u.username,
@@ -105,6 +71,11 @@ func (s *Storage) UserByUUID(ctx context.Context, uuid string) (*models.User, er
             u.email,
             u.role,
             u.is_blocked,
+            COALESCE(u.blocked_reason, ''),
+            u.blocked_at,
+            u.blocked_until,
+            COALESCE(u.blocked_by::text, ''),
+            u.email_verified_at,
             u.created_at,
             u.modified_at
         FROM
@@ -114,6 +85,7 @@ func (s *Storage) UserByUUID(ctx context.Context, uuid string) (*models.User, er
 	)
 
 	err := userRow.Scan(
+		&user.UUID,
 		&user.Name,
 		&user.Surname,
 		&user.Username,
@@ -121,50 +93,30 @@ func (s *Storage) UserByUUID(ctx context.Context, uuid string) (*models.User, er
 		&user.Email,
 		&user.Role,
 		&user.IsBlocked,
+		&user.BlockReason,
+		&user.BlockedAt,
+		&user.BlockedUntil,
+		&user.BlockedBy,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.ModifiedAt,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 		}
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	// Fetch the groups for the user
-	groupRows, err := s.db.Query(ctx, `
-        SELECT
-            g.name
-        FROM
-            groups g
-        JOIN
-            users_groups ug ON g.id = ug.group_id
-        WHERE
-            ug.user_id = $1`, uuid,
-	)
+	groupNames, err := s.GroupNames(ctx, uuid)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	defer groupRows.Close()
-
-	var groupNames []string
-	for groupRows.Next() {
-		var groupName string
-		if err := groupRows.Scan(&groupName); err != nil {
-			return nil, fmt.Errorf("%s: %w", op, err)
-		}
-		groupNames = append(groupNames, groupName)
-	}
-	if err := groupRows.Err(); err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
 
 	// Assign the groups to the user
 	user.Groups = groupNames
 
-	// Output fields name, surname, phone_number, role, groups
-	fmt.Printf("User: %v", user)
-
 	return &user, nil
 }
 
@@ -176,7 +128,11 @@ func (s *Storage) UserByName(ctx context.Context, username string) (*models.User
 			id,
 			username,
 			pass_hash,
-			role
+			email,
+			role,
+			is_blocked,
+			blocked_until,
+			email_verified_at
 		FROM users WHERE username=$1`, username,
 	)
 
@@ -185,10 +141,14 @@ func (s *Storage) UserByName(ctx context.Context, username string) (*models.User
 		&user.UUID,
 		&user.Username,
 		&user.PassHash,
+		&user.Email,
 		&user.Role,
+		&user.IsBlocked,
+		&user.BlockedUntil,
+		&user.EmailVerifiedAt,
 	)
 	if err != nil {
-		if errors.As(err, &pgx.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 		}
 		return nil, fmt.Errorf("%s: %w", op, err)
@@ -197,6 +157,37 @@ func (s *Storage) UserByName(ctx context.Context, username string) (*models.User
 	return &user, nil
 }
 
+func (s *Storage) UserByEmail(ctx context.Context, email string) (*models.User, error) {
+	const op = "storage.postgres.UserByEmail"
+
+	row := s.db.QueryRow(ctx, `
+		SELECT
+			id,
+			username,
+			email,
+			role,
+			email_verified_at
+		FROM users WHERE email=$1`, email,
+	)
+
+	var user models.User
+	err := row.Scan(
+		&user.UUID,
+		&user.Username,
+		&user.Email,
+		&user.Role,
+		&user.EmailVerifiedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrEmailNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &user, nil
+}
+
 func (s *Storage) SearchEmail(ctx context.Context, email string) (bool, error) {
 	const op = "storage.postgres.SearchEmail"
 
@@ -209,10 +200,181 @@ func (s *Storage) SearchEmail(ctx context.Context, email string) (bool, error) {
 	return found, nil
 }
 
-func (s *Storage) CreateNewUser(ctx context.Context, username string, email string, passHash []byte) error {
+func (s *Storage) CreateNewUser(ctx context.Context, username string, email string, passHash []byte) (string, error) {
 	const op = "storage.postgres.CreateNewUser"
 
-	_, err := s.db.Exec(ctx, `INSERT INTO users (username, email, pass_hash) VALUES ($1, $2, $3)`, username, email, passHash)
+	var uuid string
+	err := s.db.QueryRow(ctx, `INSERT INTO users (username, email, pass_hash) VALUES ($1, $2, $3) RETURNING id`, username, email, passHash).Scan(&uuid)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uuid, nil
+}
+
+// VerifyEmail marks email as verified, provided it is still the user's email and is not verified yet.
+func (s *Storage) VerifyEmail(ctx context.Context, uuid string, email string) error {
+	const op = "storage.postgres.VerifyEmail"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users SET email_verified_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND email=$2 AND email_verified_at IS NULL`, uuid, email,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrEmailAlreadyVerified)
+	}
+
+	return nil
+}
+
+// CreatePasswordResetToken stores a new reset token for the user, invalidating the ones issued before.
+func (s *Storage) CreatePasswordResetToken(ctx context.Context, uuid string, tokenHash []byte, expiresAt time.Time) error {
+	const op = "storage.postgres.CreatePasswordResetToken"
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `DELETE FROM password_reset_tokens WHERE user_id=$1 AND used_at IS NULL`, uuid)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+			VALUES ($1, $2, $3)`, uuid, tokenHash, expiresAt,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ResetPassword consumes an unused, unexpired reset token and sets the new password hash
+// of its owner in one transaction. It returns the owner's UUID.
+func (s *Storage) ResetPassword(ctx context.Context, tokenHash []byte, passHash []byte) (string, error) {
+	const op = "storage.postgres.ResetPassword"
+
+	var uuid string
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			UPDATE password_reset_tokens SET used_at=CURRENT_TIMESTAMP
+			WHERE token_hash=$1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			RETURNING user_id`, tokenHash,
+		).Scan(&uuid)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE users SET pass_hash=$1 WHERE id=$2`, passHash, uuid)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uuid, nil
+}
+
+func (s *Storage) TOTP(ctx context.Context, uuid string) (*models.TOTP, error) {
+	const op = "storage.postgres.TOTP"
+
+	var totp models.TOTP
+	err := s.db.QueryRow(ctx, `
+		SELECT secret, confirmed_at, last_used_step
+		FROM user_totp WHERE user_id=$1`, uuid,
+	).Scan(&totp.Secret, &totp.ConfirmedAt, &totp.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrTOTPNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &totp, nil
+}
+
+// SaveTOTPSecret starts a TOTP enrollment, replacing a previous unconfirmed one.
+func (s *Storage) SaveTOTPSecret(ctx context.Context, uuid string, secret string) error {
+	const op = "storage.postgres.SaveTOTPSecret"
+
+	tag, err := s.db.Exec(ctx, `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret=EXCLUDED.secret, created_at=CURRENT_TIMESTAMP
+		WHERE user_totp.confirmed_at IS NULL`, uuid, secret,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrTOTPAlreadyExists)
+	}
+
+	return nil
+}
+
+// ConfirmTOTP completes the enrollment with the step of the code the user proved it with
+// and replaces the user's recovery codes.
+func (s *Storage) ConfirmTOTP(ctx context.Context, uuid string, step int64, codeHashes [][]byte) error {
+	const op = "storage.postgres.ConfirmTOTP"
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE user_totp SET confirmed_at=CURRENT_TIMESTAMP, last_used_step=$2
+			WHERE user_id=$1 AND confirmed_at IS NULL`, uuid, step,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return storage.ErrTOTPAlreadyExists
+		}
+
+		return replaceRecoveryCodes(ctx, tx, uuid, codeHashes)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that the code of step was used, failing if it or a later one already was.
+func (s *Storage) UseTOTPStep(ctx context.Context, uuid string, step int64) error {
+	const op = "storage.postgres.UseTOTPStep"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE user_totp SET last_used_step=$2
+		WHERE user_id=$1 AND confirmed_at IS NOT NULL AND last_used_step < $2`, uuid, step,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrTOTPStepUsed)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteTOTP(ctx context.Context, uuid string) error {
+	const op = "storage.postgres.DeleteTOTP"
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id=$1`, uuid)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id=$1`, uuid)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -220,6 +382,142 @@ func (s *Storage) CreateNewUser(ctx context.Context, username string, email stri
 	return nil
 }
 
+// UseRecoveryCode consumes one of the user's unused recovery codes.
+func (s *Storage) UseRecoveryCode(ctx context.Context, uuid string, codeHash []byte) error {
+	const op = "storage.postgres.UseRecoveryCode"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE mfa_recovery_codes SET used_at=CURRENT_TIMESTAMP
+		WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL`, uuid, codeHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) ReplaceRecoveryCodes(ctx context.Context, uuid string, codeHashes [][]byte) error {
+	const op = "storage.postgres.ReplaceRecoveryCodes"
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, uuid, codeHashes)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, uuid string, codeHashes [][]byte) error {
+	_, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id=$1`, uuid)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, uuid, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SigningKeys returns the token signing keys that can still be used for verification, newest first.
+func (s *Storage) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	const op = "storage.postgres.SigningKeys"
+
+	rows, err := s.db.Query(ctx, `
+		SELECT kid, algorithm, private_key, encrypted, created_at, retired_at, expires_at
+		FROM signing_keys
+		WHERE expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var key models.SigningKey
+		err := rows.Scan(&key.ID, &key.Algorithm, &key.PrivateKey, &key.Encrypted, &key.CreatedAt, &key.RetiredAt, &key.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// RotateSigningKey makes key the active signing key unless an encrypted active key of the same
+// algorithm created after rotateBefore exists. Replaced keys stop signing now and stop verifying at expiresAt.
+// It reports whether the key was stored, so concurrent replicas rotate only once.
+func (s *Storage) RotateSigningKey(ctx context.Context, key models.SigningKey, rotateBefore, expiresAt time.Time) (bool, error) {
+	const op = "storage.postgres.RotateSigningKey"
+
+	var rotated bool
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('signing_keys'))`)
+		if err != nil {
+			return err
+		}
+
+		var fresh bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS(
+				SELECT 1 FROM signing_keys
+				WHERE retired_at IS NULL AND encrypted AND algorithm=$1 AND created_at > $2
+			)`, key.Algorithm, rotateBefore,
+		).Scan(&fresh)
+		if err != nil {
+			return err
+		}
+		if fresh {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE signing_keys SET retired_at=CURRENT_TIMESTAMP, expires_at=$1
+			WHERE retired_at IS NULL`, expiresAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO signing_keys (kid, algorithm, private_key, encrypted)
+			VALUES ($1, $2, $3, $4)`, key.ID, key.Algorithm, key.PrivateKey, key.Encrypted,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM signing_keys WHERE expires_at < CURRENT_TIMESTAMP`)
+		if err != nil {
+			return err
+		}
+
+		rotated = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rotated, nil
+}
+
 func (s *Storage) PatchUser(ctx context.Context, uuid string, user *models.User) (*models.User, error) {
 	const op = "storage.postgres.PatchUser"
 
@@ -253,24 +551,289 @@ func (s *Storage) PatchUser(ctx context.Context, uuid string, user *models.User)
 
 	queryAttrs := strings.Join(attrs, ", ")
 
-	query := "UPDATE users SET " + queryAttrs + ", modified_at=$" + strconv.Itoa(len(attrs)+1) + " WHERE id=$" + strconv.Itoa(len(attrs)+2) + " RETURNING name, surname, username, phone_number, email, role, is_blocked, created_at, modified_at"
+	query := "UPDATE users SET " + queryAttrs + ", modified_at=$" + strconv.Itoa(len(attrs)+1) + " WHERE id=$" + strconv.Itoa(len(attrs)+2) + " RETURNING " + userColumns
 
-	var u models.User
-	err := s.db.QueryRow(ctx, query, args...).Scan(&u.Name, &u.Surname, &u.Username, &u.PhoneNumber, &u.Email, &u.Role, &u.IsBlocked, &u.CreatedAt, &u.ModifiedAt)
+	u, err := scanUser(s.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return u, nil
+}
+
+// userSortColumns whitelists the columns users can be sorted by
+var userSortColumns = map[string]string{
+	"created_at": "created_at",
+	"username":   "username",
+	"email":      "email",
+}
+
+// pageCursor points right after the last row of a page
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	UUID  string `json:"id"`
+}
+
+// ListUsers returns a page of users matching filter along with the cursor of
+// the next page, which is empty on the last one.
+func (s *Storage) ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, string, error) {
+	const op = "storage.postgres.ListUsers"
+
+	column, ok := userSortColumns[filter.Sort]
+	if !ok {
+		return nil, "", fmt.Errorf("%s: unknown sort %q", op, filter.Sort)
+	}
+	direction, cmp := "ASC", ">"
+	if filter.Order == "desc" {
+		direction, cmp = "DESC", "<"
+	}
+
+	var args []interface{}
+	var conds []string
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.Role != "" {
+		conds = append(conds, "role="+arg(filter.Role))
+	}
+	if filter.Blocked != nil {
+		// Expired temporary blocks don't count
+		conds = append(conds, "(is_blocked AND (blocked_until IS NULL OR blocked_until > CURRENT_TIMESTAMP))="+arg(*filter.Blocked))
+	}
+	if filter.Email != "" {
+		conds = append(conds, "email ILIKE "+arg("%"+escapeLike(filter.Email)+"%"))
+	}
+	if filter.Username != "" {
+		conds = append(conds, "username ILIKE "+arg("%"+escapeLike(filter.Username)+"%"))
+	}
+	if filter.CreatedAfter != nil {
+		conds = append(conds, "created_at >= "+arg(filter.CreatedAfter.UTC()))
+	}
+	if filter.CreatedBefore != nil {
+		conds = append(conds, "created_at < "+arg(filter.CreatedBefore.UTC()))
+	}
+
+	if filter.Cursor != "" {
+		cur, err := decodeCursor(filter.Cursor)
+		if err != nil || cur.Sort != filter.Sort || cur.Order != filter.Order {
+			return nil, "", fmt.Errorf("%s: %w", op, storage.ErrInvalidCursor)
+		}
+
+		value := arg(cur.Value)
+		if column == "created_at" {
+			value += "::timestamp"
+		}
+		conds = append(conds, fmt.Sprintf("(%s, id) %s (%s, %s::uuid)", column, cmp, value, arg(cur.UUID)))
+	}
+
+	query := "SELECT " + userColumns + " FROM users"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	// One extra row tells whether there is a next page
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", column, direction, direction, arg(filter.Limit+1))
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(users) <= filter.Limit {
+		return users, "", nil
+	}
+	users = users[:filter.Limit]
+
+	last := users[len(users)-1]
+	cur := pageCursor{Sort: filter.Sort, Order: filter.Order, UUID: last.UUID}
+	switch column {
+	case "created_at":
+		cur.Value = last.CreatedAt.Format(time.RFC3339Nano)
+	case "username":
+		cur.Value = last.Username
+	case "email":
+		cur.Value = last.Email
+	}
+
+	next, err := encodeCursor(cur)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, next, nil
+}
+
+// UpdateUser applies an administrator's changes to any user field. Changing the email
+// makes it unverified again.
+func (s *Storage) UpdateUser(ctx context.Context, uuid string, patch models.UserPatch) (*models.User, error) {
+	const op = "storage.postgres.UpdateUser"
+
+	var args []interface{}
+	var attrs []string
+	set := func(column string, v interface{}) {
+		args = append(args, v)
+		attrs = append(attrs, column+"=$"+strconv.Itoa(len(args)))
+	}
+
+	if patch.Name != nil {
+		set("name", *patch.Name)
+	}
+	if patch.Surname != nil {
+		set("surname", *patch.Surname)
+	}
+	if patch.Username != nil {
+		set("username", *patch.Username)
+	}
+	if patch.PhoneNumber != nil {
+		set("phone_number", *patch.PhoneNumber)
+	}
+	if patch.Email != nil {
+		set("email", *patch.Email)
+		attrs = append(attrs, "email_verified_at=CASE WHEN email=$"+strconv.Itoa(len(args))+" THEN email_verified_at END")
+	}
+	if patch.Role != nil {
+		set("role", *patch.Role)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrNoFieldsToUpdate)
+	}
+
+	args = append(args, uuid)
+
+	query := "UPDATE users SET " + strings.Join(attrs, ", ") + " WHERE id=$" + strconv.Itoa(len(args)) + " RETURNING " + userColumns
+
+	u, err := scanUser(s.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return u, nil
+}
+
+// BlockUser blocks the user until the given time, or for good if until is nil.
+// Blocking an already blocked user replaces the previous block.
+func (s *Storage) BlockUser(ctx context.Context, uuid, blockedBy, reason string, until *time.Time) (*models.User, error) {
+	const op = "storage.postgres.BlockUser"
+
+	u, err := scanUser(s.db.QueryRow(ctx, `
+		UPDATE users SET
+			is_blocked=true,
+			blocked_reason=NULLIF($2, ''),
+			blocked_at=CURRENT_TIMESTAMP,
+			blocked_until=$3,
+			blocked_by=NULLIF($4, '')::uuid
+		WHERE id=$1
+		RETURNING `+userColumns, uuid, reason, until, blockedBy,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return u, nil
+}
+
+// UnblockUser lifts the user's block.
+func (s *Storage) UnblockUser(ctx context.Context, uuid string) (*models.User, error) {
+	const op = "storage.postgres.UnblockUser"
+
+	u, err := scanUser(s.db.QueryRow(ctx, `
+		UPDATE users SET
+			is_blocked=false,
+			blocked_reason=NULL,
+			blocked_at=NULL,
+			blocked_until=NULL,
+			blocked_by=NULL
+		WHERE id=$1
+		RETURNING `+userColumns, uuid,
+	))
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	return u, nil
+}
+
+// userColumns are the fields of a user returned to administrators, see scanUser
+const userColumns = `id, name, surname, username, phone_number, email, role,
+	is_blocked, COALESCE(blocked_reason, ''), blocked_at, blocked_until, COALESCE(blocked_by::text, ''),
+	email_verified_at, created_at, modified_at`
+
+func scanUser(row pgx.Row) (*models.User, error) {
+	var u models.User
+	err := row.Scan(
+		&u.UUID, &u.Name, &u.Surname, &u.Username, &u.PhoneNumber, &u.Email, &u.Role,
+		&u.IsBlocked, &u.BlockReason, &u.BlockedAt, &u.BlockedUntil, &u.BlockedBy,
+		&u.EmailVerifiedAt, &u.CreatedAt, &u.ModifiedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	return &u, nil
 }
 
+func encodeCursor(cur pageCursor) (string, error) {
+	b, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var cur pageCursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cur, err
+	}
+
+	err = json.Unmarshal(b, &cur)
+	return cur, err
+}
+
+// escapeLike makes s match literally inside a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Delete removes the user, their group memberships go along.
 func (s *Storage) Delete(ctx context.Context, uuid string) error {
 	const op = "storage.postgres.Delete"
 
-	_, err := s.db.Exec(ctx, `DELETE FROM users WHERE id=$1`, uuid)
+	tag, err := s.db.Exec(ctx, `DELETE FROM users WHERE id=$1`, uuid)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
 
 	return nil
 }
@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const serviceAccountColumns = `id, name, description, role, COALESCE(owner_group_id::text, ''),
+	COALESCE(created_by::text, ''), secret_hash, COALESCE(public_key, ''), created_at`
+
+// CreateServiceAccount stores the account, filling in its creation time.
+func (s *Storage) CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error {
+	const op = "storage.postgres.CreateServiceAccount"
+
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO service_accounts (id, name, description, role, owner_group_id, created_by, secret_hash, public_key)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, NULLIF($6, '')::uuid, $7, NULLIF($8, ''))
+		RETURNING created_at`,
+		account.ID, account.Name, account.Description, account.Role, account.OwnerGroupID,
+		account.CreatedBy, account.SecretHash, account.PublicKey,
+	).Scan(&account.CreatedAt)
+	if err != nil {
+		switch {
+		case isViolation(err, uniqueViolation):
+			return fmt.Errorf("%s: %w", op, storage.ErrServiceAccountExists)
+		case isViolation(err, foreignKeyViolation):
+			return fmt.Errorf("%s: %w", op, storage.ErrGroupNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ServiceAccount(ctx context.Context, id string) (*models.ServiceAccount, error) {
+	const op = "storage.postgres.ServiceAccount"
+
+	account, err := scanServiceAccount(s.db.QueryRow(ctx, `SELECT `+serviceAccountColumns+` FROM service_accounts WHERE id=$1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrServiceAccountNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return account, nil
+}
+
+// ServiceAccounts returns every service account by name.
+func (s *Storage) ServiceAccounts(ctx context.Context) ([]models.ServiceAccount, error) {
+	const op = "storage.postgres.ServiceAccounts"
+
+	rows, err := s.db.Query(ctx, `SELECT `+serviceAccountColumns+` FROM service_accounts ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var accounts []models.ServiceAccount
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		accounts = append(accounts, *account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accounts, nil
+}
+
+// SetServiceAccountSecret replaces the secret of the account with id.
+func (s *Storage) SetServiceAccountSecret(ctx context.Context, id string, secretHash []byte) error {
+	const op = "storage.postgres.SetServiceAccountSecret"
+
+	tag, err := s.db.Exec(ctx, `UPDATE service_accounts SET secret_hash=$2 WHERE id=$1`, id, secretHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrServiceAccountNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteServiceAccount(ctx context.Context, id string) error {
+	const op = "storage.postgres.DeleteServiceAccount"
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM service_accounts WHERE id=$1`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrServiceAccountNotFound)
+	}
+
+	return nil
+}
+
+func scanServiceAccount(row pgx.Row) (*models.ServiceAccount, error) {
+	var a models.ServiceAccount
+	err := row.Scan(&a.ID, &a.Name, &a.Description, &a.Role, &a.OwnerGroupID, &a.CreatedBy, &a.SecretHash, &a.PublicKey, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
@@ -0,0 +1,193 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"user-management-service/internal/models"
+	"user-management-service/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateSession starts a new session of the user, whose first refresh token is jti,
+// and returns its id. The user's expired and revoked sessions are cleaned up on the way.
+func (s *Storage) CreateSession(ctx context.Context, uuid, jti string, client models.Client, expiresAt time.Time) (string, error) {
+	const op = "storage.postgres.CreateSession"
+
+	var id string
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			DELETE FROM sessions
+			WHERE user_id=$1 AND (revoked_at IS NOT NULL OR expires_at <= CURRENT_TIMESTAMP)`, uuid,
+		)
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRow(ctx, `
+			INSERT INTO sessions (user_id, refresh_jti, user_agent, ip, expires_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`, uuid, jti, client.UserAgent, client.IP, expiresAt,
+		).Scan(&id)
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// RotateSession replaces the latest refresh token oldJTI of the user's active session
+// with newJTI and extends the session until expiresAt. Presenting any other token of
+// the session means it leaked: the whole session is revoked and ErrTokenReused returned.
+// Sessions started before token families have no latest token, oldJTI is empty for them.
+func (s *Storage) RotateSession(ctx context.Context, uuid, id, oldJTI, newJTI string, client models.Client, expiresAt time.Time) error {
+	const op = "storage.postgres.RotateSession"
+
+	var reused bool
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		// Locking the row makes concurrent rotations with the same token wait for each other
+		var latest *string
+		var active bool
+		err := tx.QueryRow(ctx, `
+			SELECT refresh_jti, revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			FROM sessions WHERE id=$1 AND user_id=$2
+			FOR UPDATE`, id, uuid,
+		).Scan(&latest, &active)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return storage.ErrSessionNotFound
+			}
+			return err
+		}
+		if !active {
+			return storage.ErrSessionNotFound
+		}
+
+		if storage.RefreshTokenReused(latest, oldJTI) {
+			reused = true
+			_, err = tx.Exec(ctx, `UPDATE sessions SET revoked_at=CURRENT_TIMESTAMP WHERE id=$1`, id)
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE sessions SET
+				refresh_jti=$2,
+				user_agent=$3,
+				ip=$4,
+				last_used_at=CURRENT_TIMESTAMP,
+				expires_at=$5
+			WHERE id=$1`, id, newJTI, client.UserAgent, client.IP, expiresAt,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if reused {
+		return fmt.Errorf("%s: %w", op, storage.ErrTokenReused)
+	}
+
+	return nil
+}
+
+// Sessions returns the user's active sessions, most recently used first.
+func (s *Storage) Sessions(ctx context.Context, uuid string) ([]models.Session, error) {
+	const op = "storage.postgres.Sessions"
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id, user_agent, ip, created_at, last_used_at, expires_at
+		FROM sessions
+		WHERE user_id=$1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_used_at DESC`, uuid,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var ss models.Session
+		err := rows.Scan(&ss.ID, &ss.UserUUID, &ss.UserAgent, &ss.IP, &ss.CreatedAt, &ss.LastUsedAt, &ss.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sessions = append(sessions, ss)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// Session returns the user's active session with id, along with its latest refresh token.
+func (s *Storage) Session(ctx context.Context, uuid, id string) (*models.Session, error) {
+	const op = "storage.postgres.Session"
+
+	var ss models.Session
+	err := s.db.QueryRow(ctx, `
+		SELECT id, user_id, user_agent, ip, created_at, last_used_at, expires_at, COALESCE(refresh_jti, '')
+		FROM sessions
+		WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP`, id, uuid,
+	).Scan(&ss.ID, &ss.UserUUID, &ss.UserAgent, &ss.IP, &ss.CreatedAt, &ss.LastUsedAt, &ss.ExpiresAt, &ss.RefreshJTI)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &ss, nil
+}
+
+// RevokeSession ends the user's active session.
+func (s *Storage) RevokeSession(ctx context.Context, uuid, id string) error {
+	const op = "storage.postgres.RevokeSession"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE sessions SET revoked_at=CURRENT_TIMESTAMP
+		WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL`, id, uuid,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+
+	return nil
+}
+
+// RevokeSessions ends every active session of the user and returns them.
+func (s *Storage) RevokeSessions(ctx context.Context, uuid string) ([]models.Session, error) {
+	const op = "storage.postgres.RevokeSessions"
+
+	rows, err := s.db.Query(ctx, `
+		UPDATE sessions SET revoked_at=CURRENT_TIMESTAMP
+		WHERE user_id=$1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING id, COALESCE(refresh_jti, ''), expires_at`, uuid,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		ss := models.Session{UserUUID: uuid}
+		if err := rows.Scan(&ss.ID, &ss.RefreshJTI, &ss.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sessions = append(sessions, ss)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
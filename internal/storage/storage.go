@@ -7,4 +7,38 @@ var (
 	ErrUserExists       = errors.New("user already exists")
 	ErrEmailNotFound    = errors.New("email not found")
 	ErrNoFieldsToUpdate = errors.New("no fields to update")
+
+	ErrEmailAlreadyVerified = errors.New("email already verified or changed")
+	ErrTokenNotFound        = errors.New("token not found, used or expired")
+
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	ErrGroupNotFound = errors.New("group not found")
+	ErrGroupExists   = errors.New("group already exists")
+	ErrAlreadyMember = errors.New("user is already a member of the group")
+	ErrNotMember     = errors.New("user is not a member of the group")
+
+	ErrSessionNotFound = errors.New("session not found or revoked")
+	ErrTokenReused     = errors.New("refresh token reused")
+
+	ErrClientNotFound  = errors.New("oauth client not found")
+	ErrClientExists    = errors.New("oauth client already exists")
+	ErrCodeNotFound    = errors.New("authorization code not found, used or expired")
+	ErrConsentNotFound = errors.New("consent not found")
+
+	ErrPersonalTokenNotFound = errors.New("personal access token not found")
+
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrServiceAccountExists   = errors.New("service account already exists")
+
+	ErrTOTPNotFound      = errors.New("totp not found")
+	ErrTOTPAlreadyExists = errors.New("totp already confirmed")
+	ErrTOTPStepUsed      = errors.New("totp code already used")
 )
+
+// RefreshTokenReused reports whether presenting the refresh token jti to a session whose
+// latest token is latest means the token was rotated already and leaked. Sessions started
+// before token families have no latest token, and their tokens carry no jti.
+func RefreshTokenReused(latest *string, jti string) bool {
+	return latest != nil && *latest != jti || latest == nil && jti != ""
+}